@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+// Decision is an approver's verdict on a tool call.
+type Decision int
+
+const (
+	// Allow runs the call as requested.
+	Allow Decision = iota
+	// Deny skips the call and reports Reason to the model instead.
+	Deny
+	// Edit runs the call with Arguments in place of the requested ones. The
+	// call in History is rewritten to match.
+	Edit
+)
+
+// Approval is the answer of an Approver.
+type Approval struct {
+	Decision  Decision
+	Reason    string
+	Arguments string
+}
+
+// Approver is consulted before a tool call runs. An error aborts Send.
+type Approver func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error)
+
+// SetApprover makes Send ask a before running any tool that is not
+// registered as tool.RiskReadOnly. Approvals are requested one at a time,
+// in call order, before any of a reply's calls run. A nil approver lets
+// every call run.
+func (s *Session) SetApprover(a Approver) {
+	s.approver = a
+}
+
+// approve asks the approver about each call that needs it. It returns the
+// calls to run, with edited arguments applied, and the results of the
+// denied calls at their positions. An Edit without arguments is an error.
+func (s *Session) approve(ctx context.Context, calls []provider.ToolCallPart) ([]provider.ToolCallPart, []provider.Part, error) {
+	results := make([]provider.Part, len(calls))
+	if s.approver == nil {
+		return calls, results, nil
+	}
+
+	approved := make([]provider.ToolCallPart, len(calls))
+	copy(approved, calls)
+	for i, call := range calls {
+		opts, ok := s.tools.Options(call.Name)
+		if !ok || opts.Risk == tool.RiskReadOnly {
+			continue
+		}
+		approval, err := s.approver(ctx, call, opts.Risk)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch approval.Decision {
+		case Deny:
+			content := "denied"
+			if approval.Reason != "" {
+				content += ": " + approval.Reason
+			}
+			results[i] = provider.ToolResultPart{ID: call.ID, Name: call.Name, Content: content, IsError: true}
+		case Edit:
+			if approval.Arguments == "" {
+				return nil, nil, fmt.Errorf("chat: approver edited call %q without arguments", call.Name)
+			}
+			approved[i].Arguments = approval.Arguments
+			s.editCall(i, approval.Arguments)
+		}
+	}
+	return approved, results, nil
+}
+
+// editCall rewrites the arguments of the nth tool call of the reply at the
+// end of History, so that the transcript shows the call that actually ran.
+func (s *Session) editCall(n int, arguments string) {
+	if len(s.History) == 0 || s.History[len(s.History)-1].Role != "model" {
+		return
+	}
+	parts := s.History[len(s.History)-1].Parts
+	for i, part := range parts {
+		call, ok := part.(provider.ToolCallPart)
+		if !ok {
+			continue
+		}
+		if n == 0 {
+			call.Arguments = arguments
+			parts[i] = call
+			return
+		}
+		n--
+	}
+}
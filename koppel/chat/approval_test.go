@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+func TestSession_Approver(t *testing.T) {
+	s := NewSession("test-model")
+	echo := func(ctx context.Context, arguments string) (string, error) { return arguments, nil }
+	s.RegisterTool(tool.Definition{Name: "read"}, echo, tool.WithRisk(tool.RiskReadOnly))
+	s.RegisterTool(tool.Definition{Name: "write"}, echo, tool.WithRisk(tool.RiskMutating))
+	s.RegisterTool(tool.Definition{Name: "shell"}, echo)
+
+	var asked []string
+	s.SetApprover(func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error) {
+		asked = append(asked, call.ID+" "+risk.String())
+		switch call.ID {
+		case "2":
+			return Approval{Decision: Deny, Reason: "not allowed"}, nil
+		case "3":
+			return Approval{Decision: Edit, Arguments: "safe"}, nil
+		}
+		return Approval{}, nil
+	})
+
+	calls := []provider.ToolCallPart{
+		{ID: "1", Name: "read", Arguments: "a"},
+		{ID: "2", Name: "write", Arguments: "b"},
+		{ID: "3", Name: "shell", Arguments: "rm -rf /"},
+		{ID: "4", Name: "write", Arguments: "d"},
+	}
+	results, err := s.callTools(context.Background(), calls)
+	if err != nil {
+		t.Fatalf("callTools failed: %v", err)
+	}
+
+	wantAsked := []string{"2 mutating", "3 unspecified", "4 mutating"}
+	if len(asked) != len(wantAsked) {
+		t.Fatalf("approver asked about %v, want %v", asked, wantAsked)
+	}
+	for i := range wantAsked {
+		if asked[i] != wantAsked[i] {
+			t.Errorf("approval %d = %q, want %q", i, asked[i], wantAsked[i])
+		}
+	}
+	want := []string{"a", "denied: not allowed", "safe", "d"}
+	for i, part := range results {
+		result := part.(provider.ToolResultPart)
+		if result.ID != calls[i].ID || result.Content != want[i] {
+			t.Errorf("result %d = %+v, want %q", i, result, want[i])
+		}
+	}
+	if calls[2].Arguments != "rm -rf /" {
+		t.Error("expected the caller's calls to be left untouched")
+	}
+}
+
+func TestSession_ApproverError(t *testing.T) {
+	s := NewSession("test-model")
+	ran := false
+	s.RegisterTool(tool.Definition{Name: "write"}, func(ctx context.Context, arguments string) (string, error) {
+		ran = true
+		return "", nil
+	})
+	errStop := errors.New("no operator available")
+	s.SetApprover(func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error) {
+		return Approval{}, errStop
+	})
+
+	if _, err := s.callTools(context.Background(), []provider.ToolCallPart{{Name: "write"}}); !errors.Is(err, errStop) {
+		t.Errorf("expected the approver error, got %v", err)
+	}
+	if ran {
+		t.Error("expected the tool not to run")
+	}
+}
+
+func TestSession_ApproverEdit(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{text: "Cleaning up.", calls: []provider.ToolCallPart{{ID: "call_1", Name: "shell", Arguments: `{"cmd":"rm -rf /"}`}}},
+			{text: "done"},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	var got string
+	s.RegisterTool(tool.Definition{Name: "shell"}, func(ctx context.Context, arguments string) (string, error) {
+		got = arguments
+		return "ok", nil
+	})
+	s.SetApprover(func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error) {
+		return Approval{Decision: Edit, Arguments: `{"cmd":"ls"}`}, nil
+	})
+
+	if _, err := s.Send(context.Background(), provider.TextPart("clean up")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got != `{"cmd":"ls"}` {
+		t.Errorf("expected the edited arguments to run, got %s", got)
+	}
+	call := s.History[1].Parts[1].(provider.ToolCallPart)
+	if call.Arguments != `{"cmd":"ls"}` {
+		t.Errorf("expected the call in history to be rewritten, got %s", call.Arguments)
+	}
+
+	s.SetApprover(func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error) {
+		return Approval{Decision: Edit}, nil
+	})
+	if _, err := s.callTools(context.Background(), []provider.ToolCallPart{{Name: "shell", Arguments: "{}"}}); err == nil {
+		t.Error("expected an error for an edit without arguments")
+	}
+}
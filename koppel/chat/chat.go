@@ -2,14 +2,30 @@ package chat
 
 import (
 	"context"
+	"errors"
+	"io"
+	"iter"
 
 	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
 )
 
+// ErrTruncated is returned by Send, together with the response, when the
+// reply was cut off by the output token limit.
+var ErrTruncated = errors.New("chat: response truncated by token limit")
+
 type Session struct {
-	provider provider.Provider  `json:"-"`
-	Model    string             `json:"model"`
-	History  []provider.Message `json:"history"`
+	provider provider.Provider `json:"-"`
+	tools    *tool.Registry    `json:"-"`
+	approver Approver          `json:"-"`
+
+	Model             string `json:"model"`
+	MaxToolIterations int    `json:"max_tool_iterations,omitempty"`
+	// MaxParallelTools bounds the tool calls of one reply that run at once.
+	MaxParallelTools int                `json:"max_parallel_tools,omitempty"`
+	History          []provider.Message `json:"history"`
+	// Usage accumulates the tokens consumed by every call the session made.
+	Usage provider.Usage `json:"usage"`
 }
 
 func NewSession(model string) *Session {
@@ -22,6 +38,18 @@ func (s *Session) SetProvider(p provider.Provider) {
 	s.provider = p
 }
 
+// Send appends parts as a user message and generates a reply. When tools are
+// registered, tool calls requested by the model are executed and their
+// results sent back until the model answers without calling a tool.
+//
+// If the reply hit the output token limit, Send returns it together with
+// ErrTruncated; the partial reply is kept in History so that sending a
+// follow-up such as "continue" resumes it. Tool calls of a truncated reply
+// are not run, as their arguments may be incomplete.
+//
+// Tool calls that Send does not run, because the reply was truncated, the
+// iteration cap was reached or a tool call failed, are answered with error
+// results so that History stays valid to send.
 func (s *Session) Send(ctx context.Context, parts ...provider.Part) (provider.Response, error) {
 	msg := provider.Message{
 		Role:  "user",
@@ -29,23 +57,88 @@ func (s *Session) Send(ctx context.Context, parts ...provider.Part) (provider.Re
 	}
 	s.History = append(s.History, msg)
 
-	resp, err := s.provider.GenerateContent(ctx, s.Model, s.History)
-	if err != nil {
-		return nil, err
+	for iteration := 0; ; iteration++ {
+		resp, err := s.provider.GenerateContent(ctx, s.Model, s.History, s.options()...)
+		if err != nil {
+			return nil, err
+		}
+		s.Usage = s.Usage.Add(resp.Usage())
+
+		calls := resp.ToolCalls()
+		s.History = append(s.History, modelMessage(thoughtParts(resp), resp.Text(), calls))
+
+		if resp.FinishReason() == provider.FinishReasonLength {
+			if len(calls) > 0 {
+				s.skipTools(calls, nil, "reply truncated by token limit")
+			}
+			return resp, ErrTruncated
+		}
+		more, err := s.runTools(ctx, calls, iteration)
+		if err != nil && !errors.Is(err, ErrMaxToolIterations) {
+			return nil, err
+		}
+		if !more {
+			return resp, err
+		}
 	}
+}
 
-	modelMsg := provider.Message{
-		Role: "model",
+// runTools runs the tool calls of the reply at the end of History and
+// appends their results. It reports whether the model should be asked for
+// another reply; calls it does not run are answered by skipTools.
+func (s *Session) runTools(ctx context.Context, calls []provider.ToolCallPart, iteration int) (bool, error) {
+	if len(calls) == 0 {
+		return false, nil
 	}
-	if thought := resp.Thought(); thought != "" {
-		modelMsg.Parts = append(modelMsg.Parts, provider.ThoughtPart(thought))
+	if s.tools == nil || s.tools.Len() == 0 {
+		s.skipTools(calls, nil, "no tools are available")
+		return false, nil
+	}
+	if iteration+1 >= s.maxToolIterations() {
+		s.skipTools(calls, nil, "tool iteration limit reached")
+		return false, ErrMaxToolIterations
 	}
-	modelMsg.Parts = append(modelMsg.Parts, provider.TextPart(resp.Text()))
-	s.History = append(s.History, modelMsg)
 
-	return resp, nil
+	results, err := s.callTools(ctx, calls)
+	if err != nil {
+		s.skipTools(calls, results, err.Error())
+		return false, err
+	}
+	s.History = append(s.History, provider.Message{
+		Role:  "tool",
+		Parts: results,
+	})
+	return true, nil
+}
+
+// skipTools answers the calls that have no result with an error naming
+// reason, so that the History stays valid to send again when Send stops
+// before running every call of a reply.
+func (s *Session) skipTools(calls []provider.ToolCallPart, results []provider.Part, reason string) {
+	parts := make([]provider.Part, len(calls))
+	for i, call := range calls {
+		if i < len(results) && results[i] != nil {
+			parts[i] = results[i]
+			continue
+		}
+		parts[i] = provider.ToolResultPart{
+			ID:      call.ID,
+			Name:    call.Name,
+			Content: "not executed: " + reason,
+			IsError: true,
+		}
+	}
+	s.History = append(s.History, provider.Message{
+		Role:  "tool",
+		Parts: parts,
+	})
 }
 
+// SendStream appends parts as a user message and streams the reply. Tool
+// calls are handled as by Send: when the streamed reply ends with calls, they
+// are run and the stream continues with the chunks of the model's next reply.
+// A truncated reply ends the stream, and the stream reports the errors Send
+// would return, such as ErrMaxToolIterations, in place of io.EOF.
 func (s *Session) SendStream(ctx context.Context, parts ...provider.Part) (provider.StreamResponse, error) {
 	msg := provider.Message{
 		Role:  "user",
@@ -53,43 +146,134 @@ func (s *Session) SendStream(ctx context.Context, parts ...provider.Part) (provi
 	}
 	s.History = append(s.History, msg)
 
-	stream, err := s.provider.GenerateContentStream(ctx, s.Model, s.History)
+	stream, err := s.provider.GenerateContentStream(ctx, s.Model, s.History, s.options()...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &chatStreamResponse{
+		ctx:     ctx,
 		session: s,
 		stream:  stream,
 	}, nil
 }
 
+// Cost prices the session's accumulated usage with the entry for its model.
+// It reports false if prices has no entry for the model.
+func (s *Session) Cost(prices provider.PricingTable) (float64, bool) {
+	return prices.Cost(s.Model, s.Usage)
+}
+
+func modelMessage(thoughts []provider.ThoughtPart, text string, calls []provider.ToolCallPart) provider.Message {
+	modelMsg := provider.Message{
+		Role: "model",
+	}
+	for _, thought := range thoughts {
+		modelMsg.Parts = append(modelMsg.Parts, thought)
+	}
+	if text != "" || len(calls) == 0 {
+		modelMsg.Parts = append(modelMsg.Parts, provider.TextPart(text))
+	}
+	for _, call := range calls {
+		modelMsg.Parts = append(modelMsg.Parts, call)
+	}
+	return modelMsg
+}
+
+// thoughtParts returns the thoughts of resp, with their signatures if the
+// provider reports them.
+func thoughtParts(resp provider.Response) []provider.ThoughtPart {
+	if tr, ok := resp.(provider.ThoughtResponse); ok {
+		return tr.ThoughtParts()
+	}
+	if thought := resp.Thought(); thought != "" {
+		return []provider.ThoughtPart{{Text: thought}}
+	}
+	return nil
+}
+
 type chatStreamResponse struct {
-	session *Session
-	stream  provider.StreamResponse
-	text    string
-	thought string
+	ctx       context.Context
+	session   *Session
+	stream    provider.StreamResponse
+	iteration int
+	text      string
+	thought   string
+	thoughts  []provider.ThoughtPart
+	calls     []provider.ToolCallPart
+	usage     provider.Usage
+	finish    provider.FinishReason
+	// done is set once the last reply has been saved to History.
+	done bool
 }
 
 func (r *chatStreamResponse) Next() (provider.Response, error) {
-	resp, err := r.stream.Next()
-	if err != nil {
-		if err.Error() == "no more stream items" {
-			// End of stream, save to history
-			modelMsg := provider.Message{
-				Role: "model",
-			}
-			if r.thought != "" {
-				modelMsg.Parts = append(modelMsg.Parts, provider.ThoughtPart(r.thought))
+	for {
+		if r.done {
+			return nil, io.EOF
+		}
+		resp, err := r.stream.Next()
+		if errors.Is(err, io.EOF) {
+			if err := r.endReply(); err != nil {
+				return nil, err
 			}
-			modelMsg.Parts = append(modelMsg.Parts, provider.TextPart(r.text))
-			r.session.History = append(r.session.History, modelMsg)
+			continue
 		}
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
+		r.text += resp.Text()
+		r.thought += resp.Thought()
+		for _, p := range thoughtParts(resp) {
+			r.thoughts = provider.AppendThought(r.thoughts, p)
+		}
+		r.calls = append(r.calls, resp.ToolCalls()...)
+		if u := resp.Usage(); !u.IsZero() {
+			r.usage = u
+		}
+		if f := resp.FinishReason(); f != provider.FinishReasonUnspecified {
+			r.finish = f
+		}
+		return resp, nil
+	}
+}
+
+// endReply saves the finished reply to History and runs its tool calls. If
+// the model is to reply again, it switches to a stream of the next reply;
+// otherwise it marks the stream done.
+func (r *chatStreamResponse) endReply() error {
+	s := r.session
+	s.History = append(s.History, modelMessage(r.thoughts, r.text, r.calls))
+	s.Usage = s.Usage.Add(r.usage)
+
+	if r.finish == provider.FinishReasonLength {
+		if len(r.calls) > 0 {
+			s.skipTools(r.calls, nil, "reply truncated by token limit")
+		}
+		r.done = true
+		return nil
+	}
+	more, err := s.runTools(r.ctx, r.calls, r.iteration)
+	if !more {
+		r.done = true
+		return err
+	}
+
+	stream, err := s.provider.GenerateContentStream(r.ctx, s.Model, s.History, s.options()...)
+	if err != nil {
+		r.done = true
+		return err
 	}
-	r.text += resp.Text()
-	r.thought += resp.Thought()
-	return resp, nil
+	r.stream.Close()
+	r.stream = stream
+	r.iteration++
+	r.text, r.thought, r.thoughts, r.calls = "", "", nil, nil
+	r.usage, r.finish = provider.Usage{}, provider.FinishReasonUnspecified
+	return nil
+}
+
+func (r *chatStreamResponse) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(r)
 }
 
 func (r *chatStreamResponse) Close() error {
@@ -99,3 +283,21 @@ func (r *chatStreamResponse) Close() error {
 func (r *chatStreamResponse) Thought() string {
 	return r.thought
 }
+
+// ToolCalls returns the complete tool calls of the current reply received so
+// far. They are run once the reply ends.
+func (r *chatStreamResponse) ToolCalls() []provider.ToolCallPart {
+	return r.calls
+}
+
+// FinishReason reports why the streamed reply stopped, once its final chunk
+// has been read.
+func (r *chatStreamResponse) FinishReason() provider.FinishReason {
+	return r.finish
+}
+
+// Truncated reports whether the streamed reply was cut off by the output
+// token limit.
+func (r *chatStreamResponse) Truncated() bool {
+	return r.finish == provider.FinishReasonLength
+}
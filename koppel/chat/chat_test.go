@@ -2,10 +2,15 @@ package chat
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"io"
+	"iter"
+	"reflect"
+	"slices"
 	"testing"
 
 	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
 )
 
 type mockProvider struct {
@@ -14,7 +19,7 @@ type mockProvider struct {
 
 func (m *mockProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
 	m.lastMessages = messages
-	return &mockResponse{text: "mock response"}, nil
+	return &mockResponse{text: "mock response", usage: provider.Usage{InputTokens: 10, OutputTokens: 5}}, nil
 }
 
 func (m *mockProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
@@ -23,7 +28,10 @@ func (m *mockProvider) GenerateContentStream(ctx context.Context, model string,
 }
 
 type mockResponse struct {
-	text string
+	text   string
+	calls  []provider.ToolCallPart
+	usage  provider.Usage
+	finish provider.FinishReason
 }
 
 func (r *mockResponse) Text() string {
@@ -35,7 +43,15 @@ func (r *mockResponse) Thought() string {
 }
 
 func (r *mockResponse) ToolCalls() []provider.ToolCallPart {
-	return nil
+	return r.calls
+}
+
+func (r *mockResponse) Usage() provider.Usage {
+	return r.usage
+}
+
+func (r *mockResponse) FinishReason() provider.FinishReason {
+	return r.finish
 }
 
 // Added mockStreamResponse for streaming tests
@@ -46,10 +62,14 @@ type mockStreamResponse struct {
 
 func (s *mockStreamResponse) Next() (provider.Response, error) {
 	if s.sent {
-		return nil, fmt.Errorf("no more stream items")
+		return nil, io.EOF
 	}
 	s.sent = true
-	return &mockResponse{text: s.text}, nil
+	return &mockResponse{text: s.text, usage: provider.Usage{InputTokens: 10, OutputTokens: 5}}, nil
+}
+
+func (s *mockStreamResponse) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
 }
 
 func (s *mockStreamResponse) Close() error {
@@ -78,6 +98,17 @@ func TestSession_Send(t *testing.T) {
 	if mock.lastMessages[0].Role != "user" {
 		t.Errorf("mock received wrong history")
 	}
+
+	if _, err := s.Send(ctx, provider.TextPart("again")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if want := (provider.Usage{InputTokens: 20, OutputTokens: 10}); s.Usage != want {
+		t.Errorf("expected accumulated usage %+v, got %+v", want, s.Usage)
+	}
+	cost, ok := s.Cost(provider.PricingTable{"test-model": {InputPerMillion: 1e6, OutputPerMillion: 2e6}})
+	if !ok || cost != 40 {
+		t.Errorf("expected cost 40, got %v (%v)", cost, ok)
+	}
 }
 
 func TestSession_SendStream(t *testing.T) {
@@ -92,13 +123,9 @@ func TestSession_SendStream(t *testing.T) {
 	}
 
 	var text string
-	for {
-		resp, err := stream.Next()
+	for resp, err := range stream.All() {
 		if err != nil {
-			if err.Error() == "no more stream items" {
-				break
-			}
-			t.Fatalf("stream.Next() failed: %v", err)
+			t.Fatalf("stream failed: %v", err)
 		}
 		text += resp.Text()
 	}
@@ -110,4 +137,187 @@ func TestSession_SendStream(t *testing.T) {
 	if len(s.History) != 2 {
 		t.Errorf("expected 2 messages in history, got %d", len(s.History))
 	}
+
+	if s.Usage.TotalTokens() != 15 {
+		t.Errorf("expected stream usage to be accumulated, got %+v", s.Usage)
+	}
+
+	for range 2 {
+		if _, err := stream.Next(); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected io.EOF after the end of the stream, got %v", err)
+		}
+	}
+	if len(s.History) != 2 || s.Usage.TotalTokens() != 15 {
+		t.Errorf("expected the reply to be saved once, got %d messages and %+v", len(s.History), s.Usage)
+	}
+}
+
+// toolCallStreamProvider streams a tool call, then answers with text, and
+// records the messages of each request.
+type toolCallStreamProvider struct {
+	mockProvider
+	requests [][]provider.Message
+}
+
+func (m *toolCallStreamProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	m.requests = append(m.requests, slices.Clone(messages))
+	if messages[len(messages)-1].Role == "tool" {
+		return &scriptedStream{chunks: []provider.Response{&mockResponse{text: "It is sunny."}}}, nil
+	}
+	return &scriptedStream{chunks: []provider.Response{
+		&mockResponse{text: "Let me check."},
+		&mockResponse{
+			calls:  []provider.ToolCallPart{{ID: "call_1", Name: "weather", Arguments: `{"city":"Seoul"}`}},
+			finish: provider.FinishReasonToolCalls,
+		},
+	}}, nil
+}
+
+type scriptedStream struct {
+	chunks []provider.Response
+}
+
+func (s *scriptedStream) Next() (provider.Response, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *scriptedStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s *scriptedStream) Close() error {
+	return nil
+}
+
+func TestSession_SendStreamToolCalls(t *testing.T) {
+	p := &toolCallStreamProvider{}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	s.RegisterTool(tool.Definition{Name: "weather"}, func(ctx context.Context, arguments string) (string, error) {
+		return "sunny", nil
+	})
+
+	stream, err := s.SendStream(context.Background(), provider.TextPart("weather?"))
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	var text string
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		text += resp.Text()
+	}
+	if text != "Let me check.It is sunny." {
+		t.Errorf("expected both replies to be streamed, got %q", text)
+	}
+
+	roles := make([]string, len(s.History))
+	for i, msg := range s.History {
+		roles[i] = msg.Role
+	}
+	if !slices.Equal(roles, []string{"user", "model", "tool", "model"}) {
+		t.Fatalf("unexpected history roles %v", roles)
+	}
+	call, ok := s.History[1].Parts[1].(provider.ToolCallPart)
+	if !ok || call.ID != "call_1" || call.Arguments != `{"city":"Seoul"}` {
+		t.Errorf("expected tool call to be persisted, got %+v", s.History[1].Parts)
+	}
+	result, ok := s.History[2].Parts[0].(provider.ToolResultPart)
+	if !ok || result.ID != "call_1" || result.Content != "sunny" {
+		t.Errorf("expected the call to be answered, got %+v", s.History[2].Parts)
+	}
+
+	stream, err = s.SendStream(context.Background(), provider.TextPart("and tomorrow?"))
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+	if sent := p.requests[2]; len(sent) != 5 || sent[3].Role != "model" || sent[4].Role != "user" {
+		t.Errorf("expected the follow-up after the answered call, got %+v", sent)
+	}
+}
+
+func TestSession_SendStreamWithoutTools(t *testing.T) {
+	p := &toolCallStreamProvider{}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+
+	stream, err := s.SendStream(context.Background(), provider.TextPart("weather?"))
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+	if len(s.History) != 3 || s.History[2].Role != "tool" {
+		t.Fatalf("expected the call to be answered, got %+v", s.History)
+	}
+
+	if _, err := s.Send(context.Background(), provider.TextPart("never mind")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if sent := p.lastMessages; len(sent) != 4 || sent[2].Role != "tool" || sent[3].Role != "user" {
+		t.Errorf("expected the follow-up after the answered call, got %+v", sent)
+	}
+}
+
+// thoughtResponse is a chunk that reports signed thought fragments.
+type thoughtResponse struct {
+	mockResponse
+	thoughts []provider.ThoughtPart
+}
+
+func (r *thoughtResponse) ThoughtParts() []provider.ThoughtPart {
+	return r.thoughts
+}
+
+func TestSession_SendStreamThoughts(t *testing.T) {
+	s := NewSession("test-model")
+	s.SetProvider(&thoughtStreamProvider{chunks: []provider.Response{
+		&thoughtResponse{thoughts: []provider.ThoughtPart{{Text: "Let me ", Provider: "anthropic"}}},
+		&thoughtResponse{thoughts: []provider.ThoughtPart{{Text: "see.", Provider: "anthropic"}}},
+		&thoughtResponse{thoughts: []provider.ThoughtPart{{Signature: "sig-1", Provider: "anthropic"}}},
+		&thoughtResponse{thoughts: []provider.ThoughtPart{{Signature: "encrypted", Redacted: true, Provider: "anthropic"}}},
+		&mockResponse{text: "Hi"},
+	}})
+
+	stream, err := s.SendStream(context.Background(), provider.TextPart("hello"))
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+
+	want := []provider.Part{
+		provider.ThoughtPart{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+		provider.ThoughtPart{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+		provider.TextPart("Hi"),
+	}
+	if len(s.History) != 2 || !reflect.DeepEqual(s.History[1].Parts, want) {
+		t.Errorf("expected signed thoughts in history, got %+v", s.History)
+	}
+}
+
+type thoughtStreamProvider struct {
+	mockProvider
+	chunks []provider.Response
+}
+
+func (m *thoughtStreamProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	return &scriptedStream{chunks: m.chunks}, nil
 }
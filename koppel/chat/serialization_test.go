@@ -21,7 +21,7 @@ func TestSession_Serialization(t *testing.T) {
 		{
 			Role: "model",
 			Parts: []provider.Part{
-				provider.ThoughtPart("thinking..."),
+				provider.ThoughtPart{Text: "thinking..."},
 				provider.TextPart("hi there!"),
 			},
 		},
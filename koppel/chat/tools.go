@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+const (
+	// DefaultMaxToolIterations bounds the number of model turns Send
+	// performs when MaxToolIterations is not set.
+	DefaultMaxToolIterations = 10
+	// DefaultMaxParallelTools bounds the tool calls Send runs at once when
+	// MaxParallelTools is not set.
+	DefaultMaxParallelTools = 4
+)
+
+// ErrMaxToolIterations is returned by Send, together with the last response,
+// when the model keeps calling tools after the iteration cap is reached.
+var ErrMaxToolIterations = errors.New("chat: maximum tool iterations exceeded")
+
+// SetTools makes the tools in r available to the model and dispatches the
+// calls it requests to their handlers.
+func (s *Session) SetTools(r *tool.Registry) {
+	s.tools = r
+}
+
+// Tools returns the session's tool registry, or nil if none is set.
+func (s *Session) Tools() *tool.Registry {
+	return s.tools
+}
+
+// RegisterTool adds a single tool to the session's registry, creating the
+// registry on first use.
+func (s *Session) RegisterTool(def tool.Definition, h tool.Handler, options ...tool.Option) error {
+	if s.tools == nil {
+		s.tools = tool.NewRegistry()
+	}
+	return s.tools.Add(def, h, options...)
+}
+
+func (s *Session) options() []provider.Option {
+	if s.tools == nil || s.tools.Len() == 0 {
+		return nil
+	}
+	return []provider.Option{provider.WithTools(s.tools.Definitions()...)}
+}
+
+func (s *Session) maxToolIterations() int {
+	if s.MaxToolIterations > 0 {
+		return s.MaxToolIterations
+	}
+	return DefaultMaxToolIterations
+}
+
+func (s *Session) maxParallelTools() int {
+	if s.MaxParallelTools > 0 {
+		return s.MaxParallelTools
+	}
+	return DefaultMaxParallelTools
+}
+
+// callTools executes calls and returns their results in call order. Calls
+// run concurrently, at most maxParallelTools at a time, except that a tool
+// registered as sequential runs alone once the calls before it finished.
+// Handler failures are reported to the model as the tool result so it can
+// recover; only context and approver errors abort. Arguments rejected by the
+// tool's input schema are reported as a JSON object listing the issues, for
+// the model to correct the call. On error, the results of the calls that
+// finished are returned with it, leaving nil at the others.
+func (s *Session) callTools(ctx context.Context, calls []provider.ToolCallPart) ([]provider.Part, error) {
+	calls, results, err := s.approve(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(calls); {
+		end := start + 1
+		if !s.sequential(calls[start].Name) {
+			for end < len(calls) && !s.sequential(calls[end].Name) {
+				end++
+			}
+		}
+		if err := s.callBatch(ctx, calls[start:end], results[start:end]); err != nil {
+			return results, err
+		}
+		start = end
+	}
+	return results, nil
+}
+
+// callBatch runs calls concurrently and stores their results. Calls that
+// already have a result, such as denied ones, are skipped.
+func (s *Session) callBatch(ctx context.Context, calls []provider.ToolCallPart, results []provider.Part) error {
+	sem := make(chan struct{}, s.maxParallelTools())
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if results[i] != nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.callTool(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Session) callTool(ctx context.Context, call provider.ToolCallPart) provider.ToolResultPart {
+	content, err := s.tools.Call(ctx, call.Name, call.Arguments)
+	if err != nil {
+		content = errorContent(err)
+	}
+	return provider.ToolResultPart{
+		ID:      call.ID,
+		Name:    call.Name,
+		Content: content,
+		IsError: err != nil,
+	}
+}
+
+func (s *Session) sequential(name string) bool {
+	opts, _ := s.tools.Options(name)
+	return opts.Sequential
+}
+
+// errorContent describes a failed tool call to the model.
+func errorContent(err error) string {
+	var verr *tool.ValidationError
+	if errors.As(err, &verr) {
+		b, _ := json.Marshal(struct {
+			Error  string       `json:"error"`
+			Issues []tool.Issue `json:"issues"`
+		}{"invalid arguments", verr.Issues})
+		return string(b)
+	}
+	return err.Error()
+}
@@ -0,0 +1,396 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+type scriptedProvider struct {
+	responses []*scriptedResponse
+	calls     int
+	options   []provider.Options
+	messages  [][]provider.Message
+}
+
+func (p *scriptedProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	p.options = append(p.options, opts)
+	p.messages = append(p.messages, slices.Clone(messages))
+	resp := p.responses[p.calls%len(p.responses)]
+	p.calls++
+	return resp, nil
+}
+
+func (p *scriptedProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+type scriptedResponse struct {
+	text   string
+	calls  []provider.ToolCallPart
+	finish provider.FinishReason
+}
+
+func (r *scriptedResponse) Text() string                        { return r.text }
+func (r *scriptedResponse) Thought() string                     { return "" }
+func (r *scriptedResponse) ToolCalls() []provider.ToolCallPart  { return r.calls }
+func (r *scriptedResponse) Usage() provider.Usage               { return provider.Usage{} }
+func (r *scriptedResponse) FinishReason() provider.FinishReason { return r.finish }
+
+func TestSession_SendToolLoop(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "call_1", Name: "weather", Arguments: `{"city":"Seoul"}`}}},
+			{text: "It is sunny in Seoul."},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+
+	var gotArgs string
+	type weatherInput struct {
+		City string `json:"city"`
+	}
+	tools := tool.NewRegistry()
+	err := tool.Register(tools, "weather", "current weather", func(ctx context.Context, in weatherInput) (string, error) {
+		gotArgs = in.City
+		return "sunny", nil
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	s.SetTools(tools)
+
+	resp, err := s.Send(context.Background(), provider.TextPart("weather in Seoul?"))
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp.Text() != "It is sunny in Seoul." {
+		t.Errorf("unexpected final text: %q", resp.Text())
+	}
+	if gotArgs != "Seoul" {
+		t.Errorf("unexpected tool arguments: %s", gotArgs)
+	}
+	if p.calls != 2 {
+		t.Fatalf("expected 2 provider calls, got %d", p.calls)
+	}
+	if len(p.options[0].Tools) != 1 || p.options[0].Tools[0].Name != "weather" {
+		t.Errorf("expected registered tool to be passed to provider, got %+v", p.options[0].Tools)
+	}
+
+	roles := []string{"user", "model", "tool", "model"}
+	if len(s.History) != len(roles) {
+		t.Fatalf("expected %d messages in history, got %d", len(roles), len(s.History))
+	}
+	for i, role := range roles {
+		if s.History[i].Role != role {
+			t.Errorf("message %d: expected role %s, got %s", i, role, s.History[i].Role)
+		}
+	}
+
+	if call, ok := s.History[1].Parts[0].(provider.ToolCallPart); !ok || call.ID != "call_1" {
+		t.Errorf("expected tool call part in model message, got %+v", s.History[1].Parts)
+	}
+	result, ok := s.History[2].Parts[0].(provider.ToolResultPart)
+	if !ok {
+		t.Fatalf("expected tool result part, got %T", s.History[2].Parts[0])
+	}
+	if result.ID != "call_1" || result.Name != "weather" || result.Content != "sunny" {
+		t.Errorf("unexpected tool result: %+v", result)
+	}
+}
+
+func TestSession_SendToolErrors(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{
+				{ID: "a", Name: "fail"},
+				{ID: "b", Name: "missing"},
+			}},
+			{text: "done"},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	s.RegisterTool(tool.Definition{Name: "fail"}, func(ctx context.Context, arguments string) (string, error) {
+		return "", errors.New("boom")
+	})
+
+	if _, err := s.Send(context.Background(), provider.TextPart("go")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	results := s.History[2].Parts
+	if len(results) != 2 {
+		t.Fatalf("expected 2 tool results, got %d", len(results))
+	}
+	if got := results[0].(provider.ToolResultPart); got.Content != "boom" || !got.IsError {
+		t.Errorf("unexpected handler error result: %+v", got)
+	}
+	if got := results[1].(provider.ToolResultPart).Content; got != `unknown tool "missing"` {
+		t.Errorf("unexpected unknown tool result: %q", got)
+	}
+}
+
+func TestSession_SendInvalidArguments(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "a", Name: "weather", Arguments: `{"city":1}`}}},
+			{text: "done"},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	type weatherInput struct {
+		City string `json:"city"`
+	}
+	s.SetTools(tool.NewRegistry())
+	if err := tool.Register(s.Tools(), "weather", "current weather", func(ctx context.Context, in weatherInput) (string, error) {
+		t.Error("expected the handler not to run")
+		return "", nil
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	if _, err := s.Send(context.Background(), provider.TextPart("go")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	got := s.History[2].Parts[0].(provider.ToolResultPart).Content
+	want := `{"error":"invalid arguments","issues":[{"path":"city","message":"expected string, got number"}]}`
+	if got != want {
+		t.Errorf("tool result = %s, want %s", got, want)
+	}
+}
+
+func TestSession_CallToolsParallel(t *testing.T) {
+	s := NewSession("test-model")
+	s.MaxParallelTools = 2
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var log []string
+	track := func(name string, d time.Duration) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		log = append(log, "start "+name)
+		mu.Unlock()
+		time.Sleep(d)
+		mu.Lock()
+		running--
+		log = append(log, "end "+name)
+		mu.Unlock()
+	}
+	s.RegisterTool(tool.Definition{Name: "read"}, func(ctx context.Context, arguments string) (string, error) {
+		track("read"+arguments, 20*time.Millisecond)
+		return "read " + arguments, nil
+	})
+	s.RegisterTool(tool.Definition{Name: "write"}, func(ctx context.Context, arguments string) (string, error) {
+		mu.Lock()
+		if running != 0 {
+			t.Error("expected the sequential tool to run alone")
+		}
+		mu.Unlock()
+		track("write", 0)
+		return "written", nil
+	}, tool.WithSequential())
+
+	calls := []provider.ToolCallPart{
+		{ID: "1", Name: "read", Arguments: "1"},
+		{ID: "2", Name: "read", Arguments: "2"},
+		{ID: "3", Name: "read", Arguments: "3"},
+		{ID: "4", Name: "write"},
+		{ID: "5", Name: "read", Arguments: "5"},
+	}
+	results, err := s.callTools(context.Background(), calls)
+	if err != nil {
+		t.Fatalf("callTools failed: %v", err)
+	}
+	want := []string{"read 1", "read 2", "read 3", "written", "read 5"}
+	for i, part := range results {
+		result := part.(provider.ToolResultPart)
+		if result.ID != calls[i].ID || result.Content != want[i] {
+			t.Errorf("result %d = %+v, want %s", i, result, want[i])
+		}
+	}
+	if peak != 2 {
+		t.Errorf("expected at most 2 concurrent calls to be reached, got %d", peak)
+	}
+	if !slices.Contains(log[len(log)-2:], "start read5") {
+		t.Errorf("expected the call after the sequential tool to start last, got %v", log)
+	}
+}
+
+func TestSession_CallToolsCanceled(t *testing.T) {
+	s := NewSession("test-model")
+	ctx, cancel := context.WithCancel(context.Background())
+	s.RegisterTool(tool.Definition{Name: "cancel"}, func(ctx context.Context, arguments string) (string, error) {
+		cancel()
+		return "", ctx.Err()
+	})
+	s.RegisterTool(tool.Definition{Name: "wait"}, func(ctx context.Context, arguments string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	_, err := s.callTools(ctx, []provider.ToolCallPart{{Name: "wait"}, {Name: "cancel"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSession_SendMaxToolIterations(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "loop", Name: "noop"}}},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	s.MaxToolIterations = 3
+	s.RegisterTool(tool.Definition{Name: "noop"}, func(ctx context.Context, arguments string) (string, error) {
+		return "ok", nil
+	})
+
+	resp, err := s.Send(context.Background(), provider.TextPart("go"))
+	if !errors.Is(err, ErrMaxToolIterations) {
+		t.Fatalf("expected ErrMaxToolIterations, got %v", err)
+	}
+	if resp == nil {
+		t.Error("expected last response to be returned")
+	}
+	if p.calls != 3 {
+		t.Errorf("expected 3 provider calls, got %d", p.calls)
+	}
+
+	if _, err := s.Send(context.Background(), provider.TextPart("stop")); !errors.Is(err, ErrMaxToolIterations) {
+		t.Fatalf("expected ErrMaxToolIterations, got %v", err)
+	}
+	sent := p.messages[3]
+	if len(sent) != 8 {
+		t.Fatalf("expected 8 messages to be sent, got %d", len(sent))
+	}
+	answer := sent[6]
+	result, ok := answer.Parts[0].(provider.ToolResultPart)
+	if answer.Role != "tool" || !ok || result.ID != "loop" || !result.IsError || result.Content != "not executed: tool iteration limit reached" {
+		t.Errorf("expected the last call to be answered as not executed, got %+v", answer)
+	}
+	if sent[7].Role != "user" {
+		t.Errorf("expected the new user message last, got %+v", sent[7])
+	}
+}
+
+func TestSession_SendWithoutTools(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "call_1", Name: "weather"}}},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+
+	if _, err := s.Send(context.Background(), provider.TextPart("weather?")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(s.History) != 3 || s.History[2].Role != "tool" {
+		t.Fatalf("expected the call to be answered, got %+v", s.History)
+	}
+	result := s.History[2].Parts[0].(provider.ToolResultPart)
+	if result.ID != "call_1" || !result.IsError {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSession_SendApproverError(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "call_1", Name: "noop"}}},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	s.RegisterTool(tool.Definition{Name: "noop"}, func(ctx context.Context, arguments string) (string, error) {
+		return "ok", nil
+	})
+	failure := errors.New("approval unavailable")
+	s.SetApprover(func(ctx context.Context, call provider.ToolCallPart, risk tool.Risk) (Approval, error) {
+		return Approval{}, failure
+	})
+
+	if _, err := s.Send(context.Background(), provider.TextPart("go")); !errors.Is(err, failure) {
+		t.Fatalf("expected the approver error, got %v", err)
+	}
+	last := s.History[len(s.History)-1]
+	result, ok := last.Parts[0].(provider.ToolResultPart)
+	if last.Role != "tool" || !ok || result.Content != "not executed: approval unavailable" {
+		t.Errorf("expected the call to be answered as not executed, got %+v", last)
+	}
+}
+
+func TestSession_SendTruncated(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{text: "The answer is", finish: provider.FinishReasonLength},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+
+	resp, err := s.Send(context.Background(), provider.TextPart("explain"))
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if resp == nil || resp.Text() != "The answer is" {
+		t.Fatalf("expected truncated response to be returned, got %v", resp)
+	}
+	if len(s.History) != 2 {
+		t.Errorf("expected partial reply to be kept in history, got %d messages", len(s.History))
+	}
+}
+
+func TestSession_SendTruncatedToolCalls(t *testing.T) {
+	p := &scriptedProvider{
+		responses: []*scriptedResponse{
+			{calls: []provider.ToolCallPart{{ID: "call_1", Name: "noop", Arguments: `{"path":`}}, finish: provider.FinishReasonLength},
+			{text: "done"},
+		},
+	}
+	s := NewSession("test-model")
+	s.SetProvider(p)
+	ran := false
+	s.RegisterTool(tool.Definition{Name: "noop"}, func(ctx context.Context, arguments string) (string, error) {
+		ran = true
+		return "ok", nil
+	})
+
+	if _, err := s.Send(context.Background(), provider.TextPart("go")); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if ran {
+		t.Error("expected the truncated call not to run")
+	}
+	if len(s.History) != 3 || s.History[2].Role != "tool" {
+		t.Fatalf("expected the truncated call to be answered, got %+v", s.History)
+	}
+	result := s.History[2].Parts[0].(provider.ToolResultPart)
+	if result.ID != "call_1" || !result.IsError || result.Content != "not executed: reply truncated by token limit" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if _, err := s.Send(context.Background(), provider.TextPart("continue")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if sent := p.messages[1]; len(sent) != 4 || sent[3].Role != "user" {
+		t.Errorf("expected the follow-up after the answered call, got %+v", sent)
+	}
+}
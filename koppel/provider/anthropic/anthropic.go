@@ -5,17 +5,23 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/anthropics/anthropic-sdk-go/packages/param"
 	"github.com/anthropics/anthropic-sdk-go/packages/ssestream"
-	"github.com/anthropics/anthropic-sdk-go/shared/constant"
 	"gosuda.org/koppel/provider"
 )
 
 type AnthropicProvider struct {
 	client *anthropic.Client
+
+	mu     sync.Mutex
+	caches map[string]*cacheEntry
 }
 
 func NewProvider(ctx context.Context, options ...option.RequestOption) (*AnthropicProvider, error) {
@@ -26,30 +32,52 @@ func NewProvider(ctx context.Context, options ...option.RequestOption) (*Anthrop
 func (p *AnthropicProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
 	opts, err := provider.NewOptions(options...)
 	if err != nil {
-		return nil, err
+		return nil, provider.InvalidRequestError(providerName, err)
+	}
+	params, err := p.toMessageParams(model, messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
-	params := p.toMessageParams(model, messages, opts)
 	resp, err := p.client.Messages.New(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
-	return &anthropicResponse{resp: resp}, nil
+	return &anthropicResponse{resp: resp, schemaTool: schemaTool(opts)}, nil
 }
 
 func (p *AnthropicProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
 	opts, err := provider.NewOptions(options...)
 	if err != nil {
-		return nil, err
+		return nil, provider.InvalidRequestError(providerName, err)
+	}
+	params, err := p.toMessageParams(model, messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
-	params := p.toMessageParams(model, messages, opts)
 	stream := p.client.Messages.NewStreaming(ctx, params)
-	return &anthropicStreamResponse{stream: stream}, nil
+	return &anthropicStreamResponse{stream: stream, schemaTool: schemaTool(opts), schemaIndex: -1}, nil
 }
 
-func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Message, opts provider.Options) anthropic.MessageNewParams {
+func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Message, opts provider.Options) (anthropic.MessageNewParams, error) {
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
 
+	messages, cacheTTL, err := p.withCachedPrefix(model, messages, opts.CacheName)
+	if err != nil {
+		return anthropic.MessageNewParams{}, err
+	}
+	breakpoints := 0
+	cacheControl := func(cc *anthropic.CacheControlEphemeralParam) {
+		*cc = anthropic.CacheControlEphemeralParam{TTL: cacheTTL}
+		breakpoints++
+	}
+
+	if opts.SystemInstruction != "" {
+		system = append(system, anthropic.TextBlockParam{
+			Text: opts.SystemInstruction,
+		})
+	}
+
 	for _, msg := range messages {
 		if msg.Role == "system" {
 			for _, part := range msg.Parts {
@@ -59,6 +87,9 @@ func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Me
 					})
 				}
 			}
+			if msg.CacheBreakpoint && len(system) > 0 {
+				cacheControl(&system[len(system)-1].CacheControl)
+			}
 			continue
 		}
 
@@ -71,13 +102,33 @@ func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Me
 				encoded := base64.StdEncoding.EncodeToString(v.Data)
 				blocks = append(blocks, anthropic.NewImageBlockBase64(v.MIMEType, encoded))
 			case provider.ThoughtPart:
-				blocks = append(blocks, anthropic.NewThinkingBlock("", string(v)))
+				// Thinking is only accepted back with the signature it
+				// was issued with, so thoughts from elsewhere are dropped.
+				if v.Provider != providerName || v.Signature == "" {
+					continue
+				}
+				if v.Redacted {
+					blocks = append(blocks, anthropic.NewRedactedThinkingBlock(v.Signature))
+				} else {
+					blocks = append(blocks, anthropic.NewThinkingBlock(v.Signature, v.Text))
+				}
 			case provider.ToolCallPart:
 				var input any
 				json.Unmarshal([]byte(v.Arguments), &input)
 				blocks = append(blocks, anthropic.NewToolUseBlock(v.ID, input, v.Name))
 			case provider.ToolResultPart:
-				blocks = append(blocks, anthropic.NewToolResultBlock(v.ID, v.Content, false))
+				blocks = append(blocks, toolResultBlock(v))
+			}
+		}
+
+		if msg.CacheBreakpoint {
+			// Thinking blocks cannot carry cache control, so the breakpoint
+			// goes on the last block that can.
+			for i := len(blocks) - 1; i >= 0; i-- {
+				if cc := blocks[i].GetCacheControl(); cc != nil {
+					cacheControl(cc)
+					break
+				}
 			}
 		}
 
@@ -98,28 +149,80 @@ func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Me
 		MaxTokens: int64(4096),
 	}
 	if len(system) > 0 {
+		if opts.CacheSystem {
+			cacheControl(&system[len(system)-1].CacheControl)
+		}
 		params.System = system
 	}
 
+	if err := p.applyOptions(&params, opts); err != nil {
+		return params, err
+	}
+	if opts.CacheTools && len(params.Tools) > 0 {
+		cacheControl(params.Tools[len(params.Tools)-1].GetCacheControl())
+	}
+	if breakpoints > maxCacheBreakpoints {
+		return params, fmt.Errorf("at most %d cache breakpoints are supported, got %d", maxCacheBreakpoints, breakpoints)
+	}
+	return params, nil
+}
+
+// toolResultBlock converts a tool result. Images and PDF documents are
+// passed natively; other blobs are described in text.
+func toolResultBlock(r provider.ToolResultPart) anthropic.ContentBlockParamUnion {
+	block := anthropic.ToolResultBlockParam{ToolUseID: r.ID}
+	if r.IsError {
+		block.IsError = param.NewOpt(true)
+	}
+	text := func(s string) {
+		block.Content = append(block.Content, anthropic.ToolResultBlockParamContentUnion{
+			OfText: &anthropic.TextBlockParam{Text: s},
+		})
+	}
+	if r.Content != "" {
+		text(r.Content)
+	}
+	for _, part := range r.Parts {
+		switch v := part.(type) {
+		case provider.TextPart:
+			text(string(v))
+		case provider.JSONPart:
+			text(string(v))
+		case provider.BlobPart:
+			encoded := base64.StdEncoding.EncodeToString(v.Data)
+			switch {
+			case strings.HasPrefix(v.MIMEType, "image/"):
+				block.Content = append(block.Content, anthropic.ToolResultBlockParamContentUnion{
+					OfImage: &anthropic.ImageBlockParam{Source: anthropic.ImageBlockParamSourceUnion{
+						OfBase64: &anthropic.Base64ImageSourceParam{Data: encoded, MediaType: anthropic.Base64ImageSourceMediaType(v.MIMEType)},
+					}},
+				})
+			case v.MIMEType == "application/pdf":
+				block.Content = append(block.Content, anthropic.ToolResultBlockParamContentUnion{
+					OfDocument: &anthropic.DocumentBlockParam{Source: anthropic.DocumentBlockParamSourceUnion{
+						OfBase64: &anthropic.Base64PDFSourceParam{Data: encoded},
+					}},
+				})
+			default:
+				text(fmt.Sprintf("[%s attachment of %d bytes omitted]", v.MIMEType, len(v.Data)))
+			}
+		}
+	}
+	return anthropic.ContentBlockParamUnion{OfToolResult: &block}
+}
+
+func (p *AnthropicProvider) applyOptions(params *anthropic.MessageNewParams, opts provider.Options) error {
+	if opts.Seed != nil {
+		return provider.UnsupportedOptionError(providerName, "seed")
+	}
+
 	if len(opts.Tools) > 0 {
 		tools := make([]anthropic.ToolUnionParam, len(opts.Tools))
 		for i, t := range opts.Tools {
-			schema := anthropic.ToolInputSchemaParam{
-				Type: constant.Object("object"),
+			schema, err := toInputSchema(t.InputSchema)
+			if err != nil {
+				return fmt.Errorf("tool %s: %w", t.Name, err)
 			}
-			if m, ok := t.InputSchema.(map[string]interface{}); ok {
-				schema.Properties = m["properties"]
-				if req, ok := m["required"].([]interface{}); ok {
-					sReq := make([]string, len(req))
-					for j, r := range req {
-						if str, ok := r.(string); ok {
-							sReq[j] = str
-						}
-					}
-					schema.Required = sReq
-				}
-			}
-
 			tools[i] = anthropic.ToolUnionParam{
 				OfTool: &anthropic.ToolParam{
 					Name:        t.Name,
@@ -130,12 +233,87 @@ func (p *AnthropicProvider) toMessageParams(model string, messages []provider.Me
 		}
 		params.Tools = tools
 	}
+	if opts.Temperature != nil {
+		if *opts.Temperature > 1 {
+			return fmt.Errorf("temperature must be at most 1, got %v", *opts.Temperature)
+		}
+		params.Temperature = param.NewOpt(*opts.Temperature)
+	}
+	if opts.TopP != nil {
+		params.TopP = param.NewOpt(*opts.TopP)
+	}
+	if opts.TopK != nil {
+		params.TopK = param.NewOpt(int64(*opts.TopK))
+	}
+	if opts.MaxOutputTokens > 0 {
+		params.MaxTokens = int64(opts.MaxOutputTokens)
+	}
+	if len(opts.StopSequences) > 0 {
+		params.StopSequences = opts.StopSequences
+	}
+	var disableParallel param.Opt[bool]
+	if opts.ParallelToolCalls != nil && !*opts.ParallelToolCalls {
+		disableParallel = param.NewOpt(true)
+	}
+	switch opts.ToolChoice {
+	case provider.ToolChoiceAuto:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{DisableParallelToolUse: disableParallel}}
+	case provider.ToolChoiceNone:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+	case provider.ToolChoiceRequired:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{DisableParallelToolUse: disableParallel}}
+	case provider.ToolChoiceTool:
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfTool: &anthropic.ToolChoiceToolParam{Name: opts.ToolName, DisableParallelToolUse: disableParallel}}
+	default:
+		// Parallel tool use is switched off through the tool choice.
+		if disableParallel.Valid() && len(opts.Tools) > 0 {
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{DisableParallelToolUse: disableParallel}}
+		}
+	}
+	if rs := opts.ResponseSchema; rs != nil {
+		// Anthropic has no JSON response mode; the schema is offered as a
+		// tool the model is forced to call, and its input is the reply.
+		if opts.ToolChoice != "" && opts.ToolChoice != provider.ToolChoiceAuto {
+			return provider.UnsupportedOptionError(providerName, "tool choice with a response schema")
+		}
+		for _, t := range opts.Tools {
+			if t.Name == rs.Name {
+				return fmt.Errorf("response schema name %q conflicts with a tool", rs.Name)
+			}
+		}
+		schema, err := toInputSchema(rs.Schema)
+		if err != nil {
+			return fmt.Errorf("response schema: %w", err)
+		}
+		description := rs.Description
+		if description == "" {
+			description = "Respond by calling this tool with the reply as its input."
+		}
+		params.Tools = append(params.Tools, anthropic.ToolUnionParam{
+			OfTool: &anthropic.ToolParam{
+				Name:        rs.Name,
+				Description: param.NewOpt(description),
+				InputSchema: schema,
+			},
+		})
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfTool: &anthropic.ToolChoiceToolParam{Name: rs.Name}}
+	}
+	return nil
+}
 
-	return params
+// schemaTool returns the name of the tool standing in for the response
+// schema, or "" if none was requested.
+func schemaTool(opts provider.Options) string {
+	if opts.ResponseSchema == nil {
+		return ""
+	}
+	return opts.ResponseSchema.Name
 }
 
 type anthropicResponse struct {
 	resp *anthropic.Message
+	// schemaTool is the tool whose input is reported as the reply text.
+	schemaTool string
 }
 
 func (r *anthropicResponse) Text() string {
@@ -145,6 +323,12 @@ func (r *anthropicResponse) Text() string {
 			text += block.Text
 		}
 	}
+	for _, block := range r.resp.Content {
+		if block.Type == "tool_use" && r.schemaTool != "" && block.Name == r.schemaTool {
+			// The schema reply replaces any preamble the model wrote.
+			return string(block.Input)
+		}
+	}
 	return text
 }
 
@@ -158,10 +342,23 @@ func (r *anthropicResponse) Thought() string {
 	return thought
 }
 
+func (r *anthropicResponse) ThoughtParts() []provider.ThoughtPart {
+	var parts []provider.ThoughtPart
+	for _, block := range r.resp.Content {
+		switch block.Type {
+		case "thinking":
+			parts = append(parts, provider.ThoughtPart{Text: block.Thinking, Signature: block.Signature, Provider: providerName})
+		case "redacted_thinking":
+			parts = append(parts, provider.ThoughtPart{Signature: block.Data, Redacted: true, Provider: providerName})
+		}
+	}
+	return parts
+}
+
 func (r *anthropicResponse) ToolCalls() []provider.ToolCallPart {
 	var calls []provider.ToolCallPart
 	for _, block := range r.resp.Content {
-		if block.Type == "tool_use" {
+		if block.Type == "tool_use" && (r.schemaTool == "" || block.Name != r.schemaTool) {
 			b, _ := json.Marshal(block.Input)
 			calls = append(calls, provider.ToolCallPart{
 				ID:        block.ID,
@@ -173,19 +370,107 @@ func (r *anthropicResponse) ToolCalls() []provider.ToolCallPart {
 	return calls
 }
 
+func (r *anthropicResponse) Usage() provider.Usage {
+	u := r.resp.Usage
+	return toUsage(u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
+}
+
+func (r *anthropicResponse) FinishReason() provider.FinishReason {
+	if r.schemaTool != "" && r.resp.StopReason == anthropic.StopReasonToolUse {
+		return provider.FinishReasonStop
+	}
+	return toFinishReason(r.resp.StopReason)
+}
+
+func toFinishReason(reason anthropic.StopReason) provider.FinishReason {
+	switch reason {
+	case "":
+		return provider.FinishReasonUnspecified
+	case anthropic.StopReasonEndTurn, anthropic.StopReasonStopSequence:
+		return provider.FinishReasonStop
+	case anthropic.StopReasonMaxTokens, "model_context_window_exceeded":
+		return provider.FinishReasonLength
+	case anthropic.StopReasonToolUse:
+		return provider.FinishReasonToolCalls
+	case anthropic.StopReasonRefusal:
+		return provider.FinishReasonContentFilter
+	}
+	return provider.FinishReasonOther
+}
+
+// toUsage normalizes Anthropic token counts, whose input_tokens exclude the
+// tokens read from and written to the prompt cache.
+func toUsage(input, output, cacheRead, cacheCreation int64) provider.Usage {
+	return provider.Usage{
+		InputTokens:         input + cacheRead + cacheCreation,
+		OutputTokens:        output,
+		CachedInputTokens:   cacheRead,
+		CacheCreationTokens: cacheCreation,
+	}
+}
+
 type anthropicStreamResponse struct {
 	stream *ssestream.Stream[anthropic.MessageStreamEventUnion]
+	start  anthropic.Usage
+	calls  provider.ToolCallAccumulator
+	// schemaTool is the tool whose input is streamed as reply text, and
+	// schemaIndex the index of its content block once it started.
+	schemaTool  string
+	schemaIndex int64
 }
 
+// Next returns the next event. Tool use input arrives as input_json_delta
+// fragments; the complete call is reported by its content_block_stop event.
 func (s *anthropicStreamResponse) Next() (provider.Response, error) {
 	if !s.stream.Next() {
 		if err := s.stream.Err(); err != nil {
-			return nil, err
+			return nil, wrapError(err)
 		}
-		return nil, fmt.Errorf("no more stream items")
+		return nil, io.EOF
 	}
 	event := s.stream.Current()
-	return &anthropicEventResponse{event: event}, nil
+	resp := &anthropicEventResponse{event: event}
+	switch event.Type {
+	case "content_block_start":
+		if event.ContentBlock.Type == "tool_use" {
+			if s.schemaTool != "" && event.ContentBlock.Name == s.schemaTool {
+				s.schemaIndex = event.Index
+				break
+			}
+			s.calls.Add(int(event.Index), event.ContentBlock.ID, event.ContentBlock.Name, "")
+		}
+	case "content_block_delta":
+		if event.Delta.Type == "input_json_delta" {
+			if event.Index == s.schemaIndex {
+				resp.text = event.Delta.PartialJSON
+				break
+			}
+			s.calls.Add(int(event.Index), "", "", event.Delta.PartialJSON)
+		}
+	case "content_block_stop":
+		if call, ok := s.calls.Complete(int(event.Index)); ok {
+			resp.calls = []provider.ToolCallPart{call}
+		}
+	case "message_start":
+		s.start = event.Message.Usage
+	case "message_delta":
+		// message_delta carries the cumulative output tokens; input counts
+		// are only guaranteed on message_start.
+		u := event.Usage
+		input, cacheRead, cacheCreation := u.InputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens
+		if input == 0 && cacheRead == 0 && cacheCreation == 0 {
+			input, cacheRead, cacheCreation = s.start.InputTokens, s.start.CacheReadInputTokens, s.start.CacheCreationInputTokens
+		}
+		resp.usage = toUsage(input, u.OutputTokens, cacheRead, cacheCreation)
+		if s.schemaTool != "" && event.Delta.StopReason == anthropic.StopReasonToolUse {
+			resp.finish = provider.FinishReasonStop
+		}
+	}
+	return resp, nil
+}
+
+func (s *anthropicStreamResponse) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
 }
 
 func (s *anthropicStreamResponse) Close() error {
@@ -194,9 +479,18 @@ func (s *anthropicStreamResponse) Close() error {
 
 type anthropicEventResponse struct {
 	event anthropic.MessageStreamEventUnion
+	usage provider.Usage
+	calls []provider.ToolCallPart
+	// text and finish override what the event reports, for replies
+	// streamed through the response schema tool.
+	text   string
+	finish provider.FinishReason
 }
 
 func (r *anthropicEventResponse) Text() string {
+	if r.text != "" {
+		return r.text
+	}
 	if r.event.Type == "content_block_delta" {
 		if r.event.Delta.Type == "text_delta" {
 			return r.event.Delta.Text
@@ -214,18 +508,39 @@ func (r *anthropicEventResponse) Thought() string {
 	return ""
 }
 
-func (r *anthropicEventResponse) ToolCalls() []provider.ToolCallPart {
-	if r.event.Type == "content_block_start" {
-		if r.event.ContentBlock.Type == "tool_use" {
-			b, _ := json.Marshal(r.event.ContentBlock.Input)
-			return []provider.ToolCallPart{
-				{
-					ID:        r.event.ContentBlock.ID,
-					Name:      r.event.ContentBlock.Name,
-					Arguments: string(b),
-				},
-			}
+// ThoughtParts reports thinking text and signatures as they stream in, and
+// redacted thinking blocks as they start.
+func (r *anthropicEventResponse) ThoughtParts() []provider.ThoughtPart {
+	switch r.event.Type {
+	case "content_block_start":
+		if r.event.ContentBlock.Type == "redacted_thinking" {
+			return []provider.ThoughtPart{{Signature: r.event.ContentBlock.Data, Redacted: true, Provider: providerName}}
+		}
+	case "content_block_delta":
+		switch r.event.Delta.Type {
+		case "thinking_delta":
+			return []provider.ThoughtPart{{Text: r.event.Delta.Thinking, Provider: providerName}}
+		case "signature_delta":
+			return []provider.ThoughtPart{{Signature: r.event.Delta.Signature, Provider: providerName}}
 		}
 	}
 	return nil
 }
+
+func (r *anthropicEventResponse) ToolCalls() []provider.ToolCallPart {
+	return r.calls
+}
+
+func (r *anthropicEventResponse) Usage() provider.Usage {
+	return r.usage
+}
+
+func (r *anthropicEventResponse) FinishReason() provider.FinishReason {
+	if r.finish != provider.FinishReasonUnspecified {
+		return r.finish
+	}
+	if r.event.Type == "message_delta" {
+		return toFinishReason(r.event.Delta.StopReason)
+	}
+	return provider.FinishReasonUnspecified
+}
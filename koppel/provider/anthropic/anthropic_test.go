@@ -1,10 +1,14 @@
 package anthropic
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
 )
 
 func TestAnthropicProvider_Interface(t *testing.T) {
@@ -29,7 +33,10 @@ func TestToMessageParams(t *testing.T) {
 		},
 	}
 
-	params := p.toMessageParams("claude-3-5-sonnet-20240620", messages, provider.Options{})
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
 
 	if params.Model != "claude-3-5-sonnet-20240620" {
 		t.Errorf("expected model claude-3-5-sonnet-20240620, got %s", params.Model)
@@ -53,3 +60,237 @@ func TestToMessageParams(t *testing.T) {
 		t.Fatalf("expected 2 blocks, got %d", len(blocks))
 	}
 }
+
+func TestToMessageParams_ToolResult(t *testing.T) {
+	p := &AnthropicProvider{}
+	messages := []provider.Message{{
+		Role: "tool",
+		Parts: []provider.Part{
+			provider.ToolResultPart{
+				ID:      "toolu_1",
+				Content: "failed",
+				IsError: true,
+				Parts: []provider.Part{
+					provider.BlobPart{MIMEType: "image/png", Data: []byte("png")},
+					provider.BlobPart{MIMEType: "application/pdf", Data: []byte("pdf")},
+					provider.BlobPart{MIMEType: "application/zip", Data: []byte("zip")},
+				},
+			},
+		},
+	}}
+
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	result := params.Messages[0].Content[0].OfToolResult
+	if result == nil || result.ToolUseID != "toolu_1" || !result.IsError.Value {
+		t.Fatalf("expected an error tool result, got %+v", params.Messages[0].Content[0])
+	}
+	content := result.Content
+	if len(content) != 4 || content[0].OfText == nil || content[1].OfImage == nil || content[2].OfDocument == nil || content[3].OfText == nil {
+		t.Errorf("unexpected tool result content %+v", content)
+	}
+}
+
+func TestToMessageParams_Options(t *testing.T) {
+	p := &AnthropicProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTemperature(0.2),
+		provider.WithTopP(0.8),
+		provider.WithTopK(40),
+		provider.WithMaxOutputTokens(1024),
+		provider.WithStopSequences("STOP"),
+		provider.WithSystemInstruction("be brief"),
+		provider.WithToolChoice(provider.ToolChoiceRequired),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", []provider.Message{
+		{Role: "system", Parts: []provider.Part{provider.TextPart("you are a helpful assistant")}},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hello")}},
+	}, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+
+	if params.Temperature.Value != 0.2 || params.TopP.Value != 0.8 || params.TopK.Value != 40 {
+		t.Errorf("unexpected sampling params: %v, %v, %v", params.Temperature, params.TopP, params.TopK)
+	}
+	if params.MaxTokens != 1024 {
+		t.Errorf("expected max tokens 1024, got %d", params.MaxTokens)
+	}
+	if len(params.StopSequences) != 1 || params.StopSequences[0] != "STOP" {
+		t.Errorf("unexpected stop sequences: %v", params.StopSequences)
+	}
+	if len(params.System) != 2 || params.System[0].Text != "be brief" {
+		t.Errorf("expected system instruction first, got %+v", params.System)
+	}
+	if params.ToolChoice.OfAny == nil {
+		t.Errorf("expected tool choice any, got %+v", params.ToolChoice)
+	}
+}
+
+func TestToMessageParams_ForcedTool(t *testing.T) {
+	p := &AnthropicProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTools(tool.Definition{Name: "weather"}),
+		provider.WithForcedTool("weather"),
+		provider.WithParallelToolCalls(false),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", nil, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	forced := params.ToolChoice.OfTool
+	if forced == nil || forced.Name != "weather" || !forced.DisableParallelToolUse.Value {
+		t.Errorf("expected the weather tool to be forced without parallel use, got %+v", params.ToolChoice)
+	}
+
+	opts.ToolChoice, opts.ToolName = "", ""
+	params, err = p.toMessageParams("claude-3-5-sonnet-20240620", nil, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	if auto := params.ToolChoice.OfAuto; auto == nil || !auto.DisableParallelToolUse.Value {
+		t.Errorf("expected auto tool choice without parallel use, got %+v", params.ToolChoice)
+	}
+}
+
+func TestToMessageParams_ResponseSchema(t *testing.T) {
+	p := &AnthropicProvider{}
+	opts, err := provider.NewOptions(provider.WithResponseSchema("answer", map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+		"required":   []string{"city"},
+	}))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", nil, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	if len(params.Tools) != 1 || params.Tools[0].OfTool.Name != "answer" {
+		t.Fatalf("expected the schema tool, got %+v", params.Tools)
+	}
+	if req := params.Tools[0].OfTool.InputSchema.Required; len(req) != 1 || req[0] != "city" {
+		t.Errorf("expected required properties to be kept, got %v", req)
+	}
+	if params.ToolChoice.OfTool == nil || params.ToolChoice.OfTool.Name != "answer" {
+		t.Errorf("expected the schema tool to be forced, got %+v", params.ToolChoice)
+	}
+
+	opts.ToolChoice = provider.ToolChoiceNone
+	if _, err := p.toMessageParams("claude-3-5-sonnet-20240620", nil, opts); !errors.Is(err, provider.ErrUnsupportedOption) {
+		t.Errorf("expected ErrUnsupportedOption, got %v", err)
+	}
+}
+
+func TestAnthropicResponse_ResponseSchema(t *testing.T) {
+	var msg anthropic.Message
+	err := json.Unmarshal([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude","stop_reason":"tool_use",
+		"content":[{"type":"tool_use","id":"toolu_1","name":"answer","input":{"city":"Seoul"}}],
+		"usage":{"input_tokens":1,"output_tokens":1}}`), &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &anthropicResponse{resp: &msg, schemaTool: "answer"}
+	if resp.Text() != `{"city":"Seoul"}` {
+		t.Errorf("expected the tool input as text, got %q", resp.Text())
+	}
+	if len(resp.ToolCalls()) != 0 {
+		t.Errorf("expected no tool calls, got %v", resp.ToolCalls())
+	}
+	if resp.FinishReason() != provider.FinishReasonStop {
+		t.Errorf("expected stop, got %s", resp.FinishReason())
+	}
+}
+
+func TestToMessageParams_UnsupportedOptions(t *testing.T) {
+	p := &AnthropicProvider{}
+	opts, err := provider.NewOptions(provider.WithSeed(1))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+	if _, err := p.toMessageParams("claude-3-5-sonnet-20240620", nil, opts); !errors.Is(err, provider.ErrUnsupportedOption) {
+		t.Errorf("expected ErrUnsupportedOption, got %v", err)
+	}
+}
+
+func TestToFinishReason(t *testing.T) {
+	tests := map[anthropic.StopReason]provider.FinishReason{
+		"":                               provider.FinishReasonUnspecified,
+		anthropic.StopReasonEndTurn:      provider.FinishReasonStop,
+		anthropic.StopReasonStopSequence: provider.FinishReasonStop,
+		anthropic.StopReasonMaxTokens:    provider.FinishReasonLength,
+		anthropic.StopReasonToolUse:      provider.FinishReasonToolCalls,
+		anthropic.StopReasonRefusal:      provider.FinishReasonContentFilter,
+		anthropic.StopReasonPauseTurn:    provider.FinishReasonOther,
+		"model_context_window_exceeded":  provider.FinishReasonLength,
+	}
+	for in, want := range tests {
+		if got := toFinishReason(in); got != want {
+			t.Errorf("toFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnthropicResponse_ThoughtParts(t *testing.T) {
+	var msg anthropic.Message
+	err := json.Unmarshal([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude","stop_reason":"end_turn",
+		"content":[{"type":"thinking","thinking":"Let me see.","signature":"sig-1"},{"type":"redacted_thinking","data":"encrypted"},{"type":"text","text":"Hi"}],
+		"usage":{"input_tokens":1,"output_tokens":1}}`), &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := (&anthropicResponse{resp: &msg}).ThoughtParts()
+	want := []provider.ThoughtPart{
+		{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+		{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("ThoughtParts() = %+v, want %+v", parts, want)
+	}
+}
+
+func TestToMessageParams_Thinking(t *testing.T) {
+	p := &AnthropicProvider{}
+	messages := []provider.Message{{
+		Role: "model",
+		Parts: []provider.Part{
+			provider.ThoughtPart{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+			provider.ThoughtPart{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+			provider.ThoughtPart{Text: "unsigned", Provider: "anthropic"},
+			provider.ThoughtPart{Text: "from gemini", Signature: "c2ln", Provider: "gemini"},
+			provider.TextPart("Hi"),
+		},
+	}}
+
+	params, err := p.toMessageParams("claude-3-5-sonnet-20240620", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	blocks := params.Messages[0].Content
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(blocks))
+	}
+	if b := blocks[0].OfThinking; b == nil || b.Thinking != "Let me see." || b.Signature != "sig-1" {
+		t.Errorf("expected a signed thinking block, got %+v", blocks[0])
+	}
+	if b := blocks[1].OfRedactedThinking; b == nil || b.Data != "encrypted" {
+		t.Errorf("expected a redacted thinking block, got %+v", blocks[1])
+	}
+	if blocks[2].OfText == nil {
+		t.Errorf("expected a text block, got %+v", blocks[2])
+	}
+}
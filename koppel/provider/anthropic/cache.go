@@ -0,0 +1,153 @@
+package anthropic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"gosuda.org/koppel/provider"
+)
+
+// maxCacheBreakpoints is the number of cache_control blocks the Messages API
+// accepts in a single request.
+const maxCacheBreakpoints = 4
+
+// Anthropic has no named caches. A context cache is kept locally as a message
+// prefix that is prepended to requests using its name, with a cache_control
+// breakpoint at its end so the API caches it server side.
+type cacheEntry struct {
+	cache    provider.ContextCache
+	messages []provider.Message
+	ttl      anthropic.CacheControlEphemeralTTL
+}
+
+func (p *AnthropicProvider) CreateCache(ctx context.Context, model string, messages []provider.Message, displayName string, ttl time.Duration) (*provider.ContextCache, error) {
+	if len(messages) == 0 {
+		return nil, provider.InvalidRequestError(providerName, errors.New("cannot cache an empty prefix"))
+	}
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	if ttl > time.Hour {
+		return nil, provider.InvalidRequestError(providerName, fmt.Errorf("cache ttl must be at most 1h, got %v", ttl))
+	}
+	cacheTTL := anthropic.CacheControlEphemeralTTLTTL5m
+	if ttl > 5*time.Minute {
+		cacheTTL = anthropic.CacheControlEphemeralTTLTTL1h
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{
+		cache: provider.ContextCache{
+			Name:        "caches/" + hex.EncodeToString(id),
+			DisplayName: displayName,
+			Model:       model,
+			ExpireTime:  time.Now().Add(ttl),
+		},
+		messages: slices.Clone(messages),
+		ttl:      cacheTTL,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.caches == nil {
+		p.caches = make(map[string]*cacheEntry)
+	}
+	p.caches[entry.cache.Name] = entry
+	cache := entry.cache
+	return &cache, nil
+}
+
+func (p *AnthropicProvider) GetCache(ctx context.Context, name string) (*provider.ContextCache, error) {
+	entry, err := p.lookupCache(name)
+	if err != nil {
+		return nil, err
+	}
+	cache := entry.cache
+	return &cache, nil
+}
+
+func (p *AnthropicProvider) DeleteCache(ctx context.Context, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.caches[name]; !ok {
+		return cacheNotFoundError(name)
+	}
+	delete(p.caches, name)
+	return nil
+}
+
+func (p *AnthropicProvider) ListCaches(ctx context.Context) ([]*provider.ContextCache, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictExpired()
+
+	caches := make([]*provider.ContextCache, 0, len(p.caches))
+	for _, entry := range p.caches {
+		cache := entry.cache
+		caches = append(caches, &cache)
+	}
+	slices.SortFunc(caches, func(a, b *provider.ContextCache) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return caches, nil
+}
+
+func (p *AnthropicProvider) lookupCache(name string) (*cacheEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictExpired()
+
+	entry, ok := p.caches[name]
+	if !ok {
+		return nil, cacheNotFoundError(name)
+	}
+	return entry, nil
+}
+
+func cacheNotFoundError(name string) error {
+	return &provider.Error{
+		Provider: providerName,
+		Kind:     provider.ErrorKindNotFound,
+		Message:  fmt.Sprintf("cache %q not found", name),
+	}
+}
+
+func (p *AnthropicProvider) evictExpired() {
+	now := time.Now()
+	for name, entry := range p.caches {
+		if now.After(entry.cache.ExpireTime) {
+			delete(p.caches, name)
+		}
+	}
+}
+
+// withCachedPrefix prepends the messages of the named cache to messages and
+// returns the breakpoint TTL to use for the request.
+func (p *AnthropicProvider) withCachedPrefix(model string, messages []provider.Message, name string) ([]provider.Message, anthropic.CacheControlEphemeralTTL, error) {
+	if name == "" {
+		return messages, anthropic.CacheControlEphemeralTTLTTL5m, nil
+	}
+	entry, err := p.lookupCache(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if entry.cache.Model != model {
+		return nil, "", fmt.Errorf("cache %q was created for model %s, not %s", name, entry.cache.Model, model)
+	}
+
+	prefixed := make([]provider.Message, 0, len(entry.messages)+len(messages))
+	prefixed = append(prefixed, entry.messages...)
+	prefixed[len(prefixed)-1].CacheBreakpoint = true
+	prefixed = append(prefixed, messages...)
+	return prefixed, entry.ttl, nil
+}
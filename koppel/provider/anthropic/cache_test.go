@@ -0,0 +1,127 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+var _ provider.ProviderContextCacher = (*AnthropicProvider)(nil)
+
+const testModel = "claude-3-5-sonnet-20240620"
+
+func TestAnthropicProvider_ContextCache(t *testing.T) {
+	p := &AnthropicProvider{}
+	ctx := context.Background()
+
+	prefix := []provider.Message{
+		{Role: "system", Parts: []provider.Part{provider.TextPart("you are a librarian")}},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("a very long document")}},
+	}
+	cache, err := p.CreateCache(ctx, testModel, prefix, "library", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCache failed: %v", err)
+	}
+	if cache.Name == "" || cache.Model != testModel || cache.DisplayName != "library" {
+		t.Errorf("unexpected cache: %+v", cache)
+	}
+	if time.Until(cache.ExpireTime) <= 59*time.Minute {
+		t.Errorf("unexpected expire time: %v", cache.ExpireTime)
+	}
+
+	opts, err := provider.NewOptions(provider.WithCacheName(cache.Name))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+	params, err := p.toMessageParams(testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("summarize it")}},
+	}, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+	if len(params.System) != 1 || len(params.Messages) != 2 {
+		t.Fatalf("expected cached prefix to be prepended, got %d system blocks and %d messages", len(params.System), len(params.Messages))
+	}
+	if cc := params.Messages[0].Content[0].GetCacheControl(); cc.TTL != anthropic.CacheControlEphemeralTTLTTL1h {
+		t.Errorf("expected 1h breakpoint at the end of the prefix, got %+v", cc)
+	}
+	if cc := params.Messages[1].Content[0].GetCacheControl(); cc.TTL != "" {
+		t.Errorf("expected no breakpoint after the prefix, got %+v", cc)
+	}
+
+	if _, err := p.toMessageParams("claude-3-haiku-20240307", nil, opts); err == nil {
+		t.Error("expected error using a cache with a different model")
+	}
+
+	list, err := p.ListCaches(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected 1 cache, got %d (%v)", len(list), err)
+	}
+	if err := p.DeleteCache(ctx, cache.Name); err != nil {
+		t.Fatalf("DeleteCache failed: %v", err)
+	}
+	if _, err := p.GetCache(ctx, cache.Name); err == nil {
+		t.Error("expected error getting a deleted cache")
+	}
+}
+
+func TestToMessageParams_CacheBreakpoints(t *testing.T) {
+	p := &AnthropicProvider{}
+	def := tool.Definition{Name: "lookup", InputSchema: map[string]interface{}{"type": "object"}}
+	opts, err := provider.NewOptions(
+		provider.WithSystemInstruction("a long system prompt"),
+		provider.WithCacheSystem(),
+		provider.WithTools(def),
+		provider.WithCacheTools(),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	messages := []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("context"), provider.TextPart("more context")}, CacheBreakpoint: true},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("question")}},
+	}
+	params, err := p.toMessageParams(testModel, messages, opts)
+	if err != nil {
+		t.Fatalf("toMessageParams failed: %v", err)
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if n := strings.Count(string(b), `"cache_control"`); n != 3 {
+		t.Errorf("expected 3 cache_control blocks, got %d in %s", n, b)
+	}
+	if cc := params.Messages[0].Content[0].GetCacheControl(); cc.TTL != "" {
+		t.Errorf("expected breakpoint only on the last block of the message, got %+v", cc)
+	}
+	if cc := params.Messages[0].Content[1].GetCacheControl(); cc.TTL == "" {
+		t.Error("expected breakpoint on the last block of the message")
+	}
+
+	for i := range messages {
+		messages[i].CacheBreakpoint = true
+	}
+	messages = append(messages, provider.Message{Role: "user", Parts: []provider.Part{provider.TextPart("x")}, CacheBreakpoint: true})
+	if _, err := p.toMessageParams(testModel, messages, opts); err == nil {
+		t.Error("expected error with more than 4 cache breakpoints")
+	}
+}
+
+func TestAnthropicResponse_CacheUsage(t *testing.T) {
+	resp := &anthropicResponse{resp: &anthropic.Message{
+		Usage: anthropic.Usage{InputTokens: 20, OutputTokens: 7, CacheCreationInputTokens: 1200, CacheReadInputTokens: 300},
+	}}
+	want := provider.Usage{InputTokens: 1520, OutputTokens: 7, CachedInputTokens: 300, CacheCreationTokens: 1200}
+	if got := resp.Usage(); got != want {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"gosuda.org/koppel/provider"
+)
+
+const providerName = "anthropic"
+
+// streamErrorPrefix precedes the payload of error events received mid-stream,
+// which the SDK reports as plain errors.
+const streamErrorPrefix = "received error while streaming: "
+
+type errorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// wrapError converts errors returned by the Anthropic client into a
+// *provider.Error.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *provider.Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		var body errorBody
+		_ = json.Unmarshal([]byte(apiErr.RawJSON()), &body)
+		e := &provider.Error{
+			Provider:   providerName,
+			Kind:       provider.KindFromStatus(apiErr.StatusCode),
+			StatusCode: apiErr.StatusCode,
+			Message:    body.Error.Message,
+			Err:        err,
+		}
+		if apiErr.Response != nil {
+			e.RetryAfter = provider.ParseRetryAfter(apiErr.Response.Header)
+		}
+		if kind, ok := errorKind(body.Error.Type, body.Error.Message); ok {
+			e.Kind = kind
+		}
+		return e
+	}
+	if e := provider.TransportError(providerName, err); e != nil {
+		return e
+	}
+	if data, ok := strings.CutPrefix(err.Error(), streamErrorPrefix); ok {
+		var body errorBody
+		if json.Unmarshal([]byte(data), &body) == nil {
+			kind, _ := errorKind(body.Error.Type, body.Error.Message)
+			return &provider.Error{Provider: providerName, Kind: kind, Message: body.Error.Message, Err: err}
+		}
+	}
+	return &provider.Error{Provider: providerName, Kind: provider.ErrorKindUnknown, Err: err}
+}
+
+// errorKind maps the type field of an Anthropic error body.
+func errorKind(typ, message string) (provider.ErrorKind, bool) {
+	switch typ {
+	case "invalid_request_error":
+		if provider.IsContextLengthMessage(message) {
+			return provider.ErrorKindContextLength, true
+		}
+		return provider.ErrorKindInvalidRequest, true
+	case "authentication_error", "permission_error":
+		return provider.ErrorKindAuth, true
+	case "not_found_error":
+		return provider.ErrorKindNotFound, true
+	case "request_too_large":
+		// The request body exceeded the size limit, which says nothing
+		// about the context window.
+		return provider.ErrorKindInvalidRequest, true
+	case "rate_limit_error":
+		return provider.ErrorKindRateLimited, true
+	case "overloaded_error":
+		return provider.ErrorKindOverloaded, true
+	case "api_error":
+		return provider.ErrorKindServer, true
+	case "timeout_error":
+		return provider.ErrorKindTimeout, true
+	}
+	return provider.ErrorKindUnknown, false
+}
@@ -0,0 +1,127 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"gosuda.org/koppel/provider"
+)
+
+func newErrorProvider(t *testing.T, status int, header http.Header, body string) *AnthropicProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"), option.WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+func TestAnthropicProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		kind       provider.ErrorKind
+		retryAfter time.Duration
+	}{
+		{
+			name:       "overloaded",
+			status:     529,
+			header:     http.Header{"Retry-After": {"3"}},
+			body:       `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			kind:       provider.ErrorKindOverloaded,
+			retryAfter: 3 * time.Second,
+		},
+		{
+			name:   "rate limited",
+			status: 429,
+			body:   `{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your rate limit"}}`,
+			kind:   provider.ErrorKindRateLimited,
+		},
+		{
+			name:   "request too large",
+			status: 413,
+			body:   `{"type":"error","error":{"type":"request_too_large","message":"Request exceeds the maximum allowed number of bytes."}}`,
+			kind:   provider.ErrorKindInvalidRequest,
+		},
+		{
+			name:   "context length",
+			status: 400,
+			body:   `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			kind:   provider.ErrorKindContextLength,
+		},
+		{
+			name:   "permission",
+			status: 403,
+			body:   `{"type":"error","error":{"type":"permission_error","message":"Your API key does not have permission"}}`,
+			kind:   provider.ErrorKindAuth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newErrorProvider(t, tt.status, tt.header, tt.body)
+			_, err := p.GenerateContent(context.Background(), testModel, []provider.Message{
+				{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+			})
+
+			var perr *provider.Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected *provider.Error, got %T: %v", err, err)
+			}
+			if perr.Provider != "anthropic" || perr.Kind != tt.kind || perr.StatusCode != tt.status {
+				t.Errorf("unexpected error: %+v", perr)
+			}
+			if perr.RetryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %v, got %v", tt.retryAfter, perr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream_ErrorEvent(t *testing.T) {
+	p := newSSEProvider(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[],"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	)
+	stream, err := p.GenerateContentStream(context.Background(), testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var streamErr error
+	for _, err := range stream.All() {
+		streamErr = err
+	}
+	var perr *provider.Error
+	if !errors.As(streamErr, &perr) || perr.Kind != provider.ErrorKindOverloaded || perr.Message != "Overloaded" {
+		t.Fatalf("expected overloaded error, got %v", streamErr)
+	}
+}
+
+func TestAnthropicProvider_CacheNotFound(t *testing.T) {
+	p := &AnthropicProvider{}
+	_, err := p.GetCache(context.Background(), "caches/missing")
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Kind != provider.ErrorKindNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
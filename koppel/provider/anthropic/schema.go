@@ -0,0 +1,47 @@
+package anthropic
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/shared/constant"
+	"gosuda.org/koppel/tool"
+)
+
+// toInputSchema normalizes a tool input schema. Anthropic requires an object
+// schema at the top level and rejects anyOf, oneOf and allOf there; other
+// keywords are passed through.
+func toInputSchema(s interface{}) (anthropic.ToolInputSchemaParam, error) {
+	schema, err := tool.NormalizeSchema(s)
+	if err != nil {
+		return anthropic.ToolInputSchemaParam{}, err
+	}
+	if types := tool.SchemaTypes(schema); len(types) > 0 && (len(types) != 1 || types[0] != "object") {
+		return anthropic.ToolInputSchemaParam{}, errors.New("schema must describe an object")
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if _, ok := schema[key]; ok {
+			return anthropic.ToolInputSchemaParam{}, fmt.Errorf("%s is not supported at the top level of a schema", key)
+		}
+	}
+
+	out := anthropic.ToolInputSchemaParam{
+		Type:       constant.Object("object"),
+		Properties: schema["properties"],
+	}
+	if req, ok := schema["required"].([]interface{}); ok {
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				out.Required = append(out.Required, name)
+			}
+		}
+	}
+	delete(schema, "type")
+	delete(schema, "properties")
+	delete(schema, "required")
+	if len(schema) > 0 {
+		out.ExtraFields = schema
+	}
+	return out, nil
+}
@@ -0,0 +1,49 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToInputSchema(t *testing.T) {
+	schema, err := toInputSchema(json.RawMessage(`{
+		"type": "object",
+		"properties": {"node": {"$ref": "#/$defs/Node"}},
+		"required": ["node"],
+		"additionalProperties": false,
+		"$defs": {"Node": {"type": "object"}}
+	}`))
+	if err != nil {
+		t.Fatalf("toInputSchema failed: %v", err)
+	}
+	if len(schema.Required) != 1 || schema.Required[0] != "node" {
+		t.Errorf("unexpected required properties %v", schema.Required)
+	}
+	if schema.ExtraFields["$defs"] == nil || schema.ExtraFields["additionalProperties"] != false {
+		t.Errorf("expected other keywords to be passed through, got %v", schema.ExtraFields)
+	}
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["type"] != "object" || decoded["$defs"] == nil {
+		t.Errorf("unexpected encoded schema %s", b)
+	}
+}
+
+func TestToInputSchema_Errors(t *testing.T) {
+	for _, schema := range []interface{}{
+		json.RawMessage(`{"type":"string"}`),
+		json.RawMessage(`{"anyOf":[{"type":"object"}]}`),
+		json.RawMessage(`[]`),
+	} {
+		if _, err := toInputSchema(schema); err == nil {
+			t.Errorf("expected an error for %s", schema)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"gosuda.org/koppel/provider"
+)
+
+// newSSEProvider returns a provider whose Messages endpoint streams events.
+func newSSEProvider(t *testing.T, events ...string) *AnthropicProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			typ := e[strings.Index(e, `"type":"`)+8:]
+			typ = typ[:strings.Index(typ, `"`)]
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ, e)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"), option.WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+// drain reads chunks until the stream ends and returns them.
+func drain(t *testing.T, stream provider.StreamResponse) []provider.Response {
+	t.Helper()
+	var chunks []provider.Response
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		chunks = append(chunks, resp)
+	}
+	if _, err := stream.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after the last chunk, got %v", err)
+	}
+	return chunks
+}
+
+func TestAnthropicStream_Usage(t *testing.T) {
+	p := newSSEProvider(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude","usage":{"input_tokens":25,"output_tokens":1,"cache_read_input_tokens":100,"cache_creation_input_tokens":0}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+		`{"type":"message_stop"}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	var usage provider.Usage
+	var finish provider.FinishReason
+	for _, chunk := range drain(t, stream) {
+		text += chunk.Text()
+		if u := chunk.Usage(); !u.IsZero() {
+			usage = u
+		}
+		if f := chunk.FinishReason(); f != provider.FinishReasonUnspecified {
+			finish = f
+		}
+	}
+	if finish != provider.FinishReasonStop {
+		t.Errorf("expected finish reason stop, got %q", finish)
+	}
+	if text != "Hello" {
+		t.Errorf("unexpected text: %q", text)
+	}
+	want := provider.Usage{InputTokens: 125, OutputTokens: 15, CachedInputTokens: 100}
+	if usage != want {
+		t.Errorf("final usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestAnthropicStream_ToolCalls(t *testing.T) {
+	p := newSSEProvider(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude","usage":{"input_tokens":25,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Seoul\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"time","input":{}}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("weather?")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var calls []provider.ToolCallPart
+	for _, chunk := range drain(t, stream) {
+		calls = append(calls, chunk.ToolCalls()...)
+	}
+	want := []provider.ToolCallPart{
+		{ID: "toolu_1", Name: "weather", Arguments: `{"city":"Seoul"}`},
+		{ID: "toolu_2", Name: "time", Arguments: "{}"},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d tool calls, got %+v", len(want), calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestAnthropicStream_ResponseSchema(t *testing.T) {
+	p := newSSEProvider(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude","usage":{"input_tokens":25,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"answer","input":{}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"Seoul\"}"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+		`{"type":"message_stop"}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("where?")}},
+	}, provider.WithResponseSchema("answer", map[string]interface{}{"type": "object"}))
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	var finish provider.FinishReason
+	for _, chunk := range drain(t, stream) {
+		text += chunk.Text()
+		if len(chunk.ToolCalls()) > 0 {
+			t.Errorf("unexpected tool calls %v", chunk.ToolCalls())
+		}
+		if f := chunk.FinishReason(); f != provider.FinishReasonUnspecified {
+			finish = f
+		}
+	}
+	if text != `{"city":"Seoul"}` || finish != provider.FinishReasonStop {
+		t.Errorf("unexpected reply %q with finish reason %s", text, finish)
+	}
+}
+
+func TestAnthropicStream_Thinking(t *testing.T) {
+	p := newSSEProvider(t,
+		`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude","usage":{"input_tokens":25,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"see."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig-1"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"encrypted"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+		`{"type":"message_stop"}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), testModel, []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var thought string
+	var parts []provider.ThoughtPart
+	for _, chunk := range drain(t, stream) {
+		thought += chunk.Thought()
+		for _, p := range chunk.(provider.ThoughtResponse).ThoughtParts() {
+			parts = provider.AppendThought(parts, p)
+		}
+	}
+	if thought != "Let me see." {
+		t.Errorf("unexpected thought: %q", thought)
+	}
+	want := []provider.ThoughtPart{
+		{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+		{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("expected %d thought parts, got %+v", len(want), parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("thought %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
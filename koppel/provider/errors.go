@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind categorizes provider failures independently of the vendor.
+type ErrorKind string
+
+const (
+	ErrorKindUnknown         ErrorKind = "unknown"
+	ErrorKindRateLimited     ErrorKind = "rate_limited"
+	ErrorKindAuth            ErrorKind = "auth"
+	ErrorKindInvalidRequest  ErrorKind = "invalid_request"
+	ErrorKindNotFound        ErrorKind = "not_found"
+	ErrorKindContextLength   ErrorKind = "context_length_exceeded"
+	ErrorKindOverloaded      ErrorKind = "overloaded"
+	ErrorKindServer          ErrorKind = "server"
+	ErrorKindContentFiltered ErrorKind = "content_filtered"
+	ErrorKindTimeout         ErrorKind = "timeout"
+	ErrorKindCanceled        ErrorKind = "canceled"
+)
+
+// Error is the normalized error returned by every provider method. The
+// vendor error is kept as the cause and can still be reached with errors.As.
+type Error struct {
+	Provider   string
+	Kind       ErrorKind
+	StatusCode int
+	// RetryAfter is the delay suggested by the provider, or zero if none.
+	RetryAfter time.Duration
+	Message    string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: %s (status %d): %s", e.Provider, e.Kind, e.StatusCode, msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Provider, e.Kind, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same request may succeed if sent again.
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrorKindRateLimited, ErrorKindOverloaded, ErrorKindServer, ErrorKindTimeout:
+		return true
+	}
+	return false
+}
+
+// IsRetryable reports whether err is a provider Error that may succeed if the
+// request is sent again.
+func IsRetryable(err error) bool {
+	var perr *Error
+	return errors.As(err, &perr) && perr.Retryable()
+}
+
+// InvalidRequestError wraps an error detected before a request was sent.
+func InvalidRequestError(providerName string, err error) error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	return &Error{Provider: providerName, Kind: ErrorKindInvalidRequest, Message: err.Error(), Err: err}
+}
+
+// KindFromStatus maps an HTTP status code to an error kind. A status alone
+// never means ErrorKindContextLength: 413 reports an oversized request body,
+// so context length errors are detected from error codes and messages.
+func KindFromStatus(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrorKindAuth
+	case status == http.StatusNotFound:
+		return ErrorKindNotFound
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return ErrorKindTimeout
+	case status == http.StatusTooManyRequests:
+		return ErrorKindRateLimited
+	case status == http.StatusServiceUnavailable, status == 529:
+		return ErrorKindOverloaded
+	case status >= 400 && status < 500:
+		return ErrorKindInvalidRequest
+	case status >= 500:
+		return ErrorKindServer
+	}
+	return ErrorKindUnknown
+}
+
+// TransportError classifies errors that did not come from a provider API
+// response, such as context cancellation and network failures. It returns
+// nil if err is not one of them.
+func TransportError(providerName string, err error) *Error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Provider: providerName, Kind: ErrorKindTimeout, Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Provider: providerName, Kind: ErrorKindCanceled, Err: err}
+	case errors.As(err, &netErr):
+		kind := ErrorKindServer
+		if netErr.Timeout() {
+			kind = ErrorKindTimeout
+		}
+		return &Error{Provider: providerName, Kind: kind, Err: err}
+	}
+	return nil
+}
+
+// IsContextLengthMessage reports whether an error message from an API
+// describes a prompt that exceeds the model's context window.
+func IsContextLengthMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, hint := range []string{
+		"context length",
+		"context_length",
+		"context window",
+		"prompt is too long",
+		"too many tokens",
+		"maximum number of tokens",
+		"input token count",
+	} {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRetryAfter reads the retry-after-ms and Retry-After response headers.
+func ParseRetryAfter(h http.Header) time.Duration {
+	if h == nil {
+		return 0
+	}
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+	return 0
+}
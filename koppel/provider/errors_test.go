@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("slow down")
+	var err error = &Error{Provider: "openai", Kind: ErrorKindRateLimited, StatusCode: 429, Err: cause}
+	err = fmt.Errorf("call failed: %w", err)
+
+	var perr *Error
+	if !errors.As(err, &perr) {
+		t.Fatal("expected errors.As to find *Error")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the cause to be reachable with errors.Is")
+	}
+	if !IsRetryable(err) {
+		t.Error("expected rate limit errors to be retryable")
+	}
+	if got := perr.Error(); got != "openai: rate_limited (status 429): slow down" {
+		t.Errorf("unexpected message: %s", got)
+	}
+
+	if IsRetryable(&Error{Kind: ErrorKindAuth}) || IsRetryable(cause) {
+		t.Error("expected auth and plain errors not to be retryable")
+	}
+}
+
+func TestKindFromStatus(t *testing.T) {
+	tests := map[int]ErrorKind{
+		400: ErrorKindInvalidRequest,
+		401: ErrorKindAuth,
+		403: ErrorKindAuth,
+		404: ErrorKindNotFound,
+		408: ErrorKindTimeout,
+		413: ErrorKindInvalidRequest,
+		429: ErrorKindRateLimited,
+		500: ErrorKindServer,
+		503: ErrorKindOverloaded,
+		504: ErrorKindTimeout,
+		529: ErrorKindOverloaded,
+	}
+	for status, want := range tests {
+		if got := KindFromStatus(status); got != want {
+			t.Errorf("KindFromStatus(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	if e := TransportError("gemini", fmt.Errorf("wrapped: %w", context.DeadlineExceeded)); e == nil || e.Kind != ErrorKindTimeout {
+		t.Errorf("expected timeout, got %v", e)
+	}
+	if e := TransportError("gemini", context.Canceled); e == nil || e.Kind != ErrorKindCanceled {
+		t.Errorf("expected canceled, got %v", e)
+	}
+	if e := TransportError("gemini", errors.New("other")); e != nil {
+		t.Errorf("expected nil for unrelated errors, got %v", e)
+	}
+}
+
+func TestInvalidRequestError(t *testing.T) {
+	err := InvalidRequestError("openai", UnsupportedOptionError("openai", "top-k"))
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Kind != ErrorKindInvalidRequest {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+	if !errors.Is(err, ErrUnsupportedOption) {
+		t.Error("expected ErrUnsupportedOption to be preserved")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "2")
+	if got := ParseRetryAfter(h); got != 2*time.Second {
+		t.Errorf("expected 2s, got %v", got)
+	}
+	h.Set("Retry-After-Ms", "150")
+	if got := ParseRetryAfter(h); got != 150*time.Millisecond {
+		t.Errorf("expected 150ms, got %v", got)
+	}
+	h = http.Header{}
+	h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if got := ParseRetryAfter(h); got <= 50*time.Second || got > time.Minute {
+		t.Errorf("expected about a minute, got %v", got)
+	}
+	if got := ParseRetryAfter(nil); got != 0 {
+		t.Errorf("expected 0 for nil header, got %v", got)
+	}
+}
+
+func TestIsContextLengthMessage(t *testing.T) {
+	for _, msg := range []string{
+		"This model's maximum context length is 128000 tokens.",
+		"prompt is too long: 210000 tokens > 200000 maximum",
+		"The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).",
+	} {
+		if !IsContextLengthMessage(msg) {
+			t.Errorf("expected %q to be a context length message", msg)
+		}
+	}
+	if IsContextLengthMessage("invalid api key") {
+		t.Error("unexpected match")
+	}
+}
@@ -0,0 +1,163 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+	"gosuda.org/koppel/provider"
+)
+
+var _ provider.ProviderContextCacher = (*GeminiProvider)(nil)
+
+// fakeCacheServer emulates the cachedContents endpoints of the Gemini API.
+type fakeCacheServer struct {
+	mu        sync.Mutex
+	caches    map[string]map[string]interface{}
+	created   map[string]interface{}
+	generated map[string]interface{}
+}
+
+func (f *fakeCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1beta/")
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, ":generateContent"):
+		if err := json.NewDecoder(r.Body).Decode(&f.generated); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"candidates": []interface{}{map[string]interface{}{
+				"content": map[string]interface{}{"role": "model", "parts": []interface{}{map[string]interface{}{"text": "cached answer"}}},
+			}},
+		})
+	case r.Method == http.MethodPost && path == "cachedContents":
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.created = body
+		name := "cachedContents/cache-1"
+		f.caches[name] = map[string]interface{}{
+			"name":        name,
+			"displayName": body["displayName"],
+			"model":       body["model"],
+			"expireTime":  "2030-01-01T00:00:00Z",
+		}
+		json.NewEncoder(w).Encode(f.caches[name])
+	case r.Method == http.MethodGet && path == "cachedContents":
+		list := make([]interface{}, 0, len(f.caches))
+		for _, c := range f.caches {
+			list = append(list, c)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"cachedContents": list})
+	case r.Method == http.MethodGet:
+		c, ok := f.caches[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": 404, "message": "not found", "status": "NOT_FOUND"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(c)
+	case r.Method == http.MethodDelete:
+		delete(f.caches, path)
+		w.Write([]byte("{}"))
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newFakeCacheProvider(t *testing.T) (*GeminiProvider, *fakeCacheServer) {
+	t.Helper()
+	fake := &fakeCacheServer{caches: make(map[string]map[string]interface{})}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: srv.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p, fake
+}
+
+func TestGeminiProvider_ContextCache(t *testing.T) {
+	p, fake := newFakeCacheProvider(t)
+	ctx := context.Background()
+
+	messages := []provider.Message{
+		{Role: "system", Parts: []provider.Part{provider.TextPart("you are a librarian")}},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("a very long document")}},
+	}
+	cache, err := p.CreateCache(ctx, "gemini-1.5-flash-001", messages, "library", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCache failed: %v", err)
+	}
+	if cache.Name != "cachedContents/cache-1" || cache.DisplayName != "library" {
+		t.Errorf("unexpected cache: %+v", cache)
+	}
+	if !cache.ExpireTime.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expire time: %v", cache.ExpireTime)
+	}
+
+	if fake.created["ttl"] != "3600s" {
+		t.Errorf("expected ttl 3600s, got %v", fake.created["ttl"])
+	}
+	if contents, _ := fake.created["contents"].([]interface{}); len(contents) != 1 {
+		t.Errorf("expected 1 cached content, got %v", fake.created["contents"])
+	}
+	if fake.created["systemInstruction"] == nil {
+		t.Error("expected system messages to be cached as the system instruction")
+	}
+
+	resp, err := p.GenerateContent(ctx, "gemini-1.5-flash-001", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("summarize it")}},
+	}, provider.WithCacheName(cache.Name))
+	if err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	if resp.Text() != "cached answer" {
+		t.Errorf("unexpected text: %q", resp.Text())
+	}
+	if fake.generated["cachedContent"] != cache.Name {
+		t.Errorf("expected cachedContent %q in request, got %v", cache.Name, fake.generated["cachedContent"])
+	}
+
+	got, err := p.GetCache(ctx, cache.Name)
+	if err != nil {
+		t.Fatalf("GetCache failed: %v", err)
+	}
+	if got.Name != cache.Name {
+		t.Errorf("GetCache returned %q, want %q", got.Name, cache.Name)
+	}
+
+	list, err := p.ListCaches(ctx)
+	if err != nil {
+		t.Fatalf("ListCaches failed: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 cache, got %d", len(list))
+	}
+
+	if err := p.DeleteCache(ctx, cache.Name); err != nil {
+		t.Fatalf("DeleteCache failed: %v", err)
+	}
+	if _, err := p.GetCache(ctx, cache.Name); err == nil {
+		t.Error("expected error getting a deleted cache")
+	}
+}
@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/genai"
+	"gosuda.org/koppel/provider"
+)
+
+const providerName = "gemini"
+
+// wrapError converts errors returned by the genai client into a
+// *provider.Error.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *provider.Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		e := &provider.Error{
+			Provider:   providerName,
+			Kind:       provider.KindFromStatus(apiErr.Code),
+			StatusCode: apiErr.Code,
+			RetryAfter: retryDelay(apiErr.Details),
+			Message:    apiErr.Message,
+			Err:        err,
+		}
+		switch apiErr.Status {
+		case "UNAUTHENTICATED", "PERMISSION_DENIED":
+			e.Kind = provider.ErrorKindAuth
+		case "RESOURCE_EXHAUSTED":
+			e.Kind = provider.ErrorKindRateLimited
+		case "UNAVAILABLE":
+			e.Kind = provider.ErrorKindOverloaded
+		case "DEADLINE_EXCEEDED":
+			e.Kind = provider.ErrorKindTimeout
+		case "NOT_FOUND":
+			e.Kind = provider.ErrorKindNotFound
+		case "INVALID_ARGUMENT", "FAILED_PRECONDITION":
+			e.Kind = provider.ErrorKindInvalidRequest
+		}
+		if e.Kind == provider.ErrorKindInvalidRequest && provider.IsContextLengthMessage(apiErr.Message) {
+			e.Kind = provider.ErrorKindContextLength
+		}
+		return e
+	}
+	if e := provider.TransportError(providerName, err); e != nil {
+		return e
+	}
+	return &provider.Error{Provider: providerName, Kind: provider.ErrorKindUnknown, Err: err}
+}
+
+// retryDelay reads the delay from a google.rpc.RetryInfo error detail.
+func retryDelay(details []map[string]any) time.Duration {
+	for _, detail := range details {
+		if detail["@type"] != "type.googleapis.com/google.rpc.RetryInfo" {
+			continue
+		}
+		if s, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d
+			}
+		}
+	}
+	return 0
+}
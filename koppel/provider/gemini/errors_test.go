@@ -0,0 +1,122 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+	"gosuda.org/koppel/provider"
+)
+
+func newErrorProvider(t *testing.T, status int, body string) *GeminiProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: srv.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+func TestGeminiProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		kind       provider.ErrorKind
+		retryAfter time.Duration
+	}{
+		{
+			name:   "rate limited",
+			status: 429,
+			body: `{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED","details":[` +
+				`{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"30s"}]}}`,
+			kind:       provider.ErrorKindRateLimited,
+			retryAfter: 30 * time.Second,
+		},
+		{
+			name:   "context length",
+			status: 400,
+			body:   `{"error":{"code":400,"message":"The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).","status":"INVALID_ARGUMENT"}}`,
+			kind:   provider.ErrorKindContextLength,
+		},
+		{
+			name:   "auth",
+			status: 400,
+			body:   `{"error":{"code":400,"message":"API key not valid.","status":"UNAUTHENTICATED"}}`,
+			kind:   provider.ErrorKindAuth,
+		},
+		{
+			name:   "overloaded",
+			status: 503,
+			body:   `{"error":{"code":503,"message":"The model is overloaded.","status":"UNAVAILABLE"}}`,
+			kind:   provider.ErrorKindOverloaded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newErrorProvider(t, tt.status, tt.body)
+			_, err := p.GenerateContent(context.Background(), "gemini-2.5-flash", []provider.Message{
+				{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+			})
+
+			var perr *provider.Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected *provider.Error, got %T: %v", err, err)
+			}
+			if perr.Provider != "gemini" || perr.Kind != tt.kind || perr.StatusCode != tt.status {
+				t.Errorf("unexpected error: %+v", perr)
+			}
+			if perr.RetryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %v, got %v", tt.retryAfter, perr.RetryAfter)
+			}
+			var apiErr genai.APIError
+			if !errors.As(err, &apiErr) {
+				t.Error("expected the SDK error to be reachable")
+			}
+		})
+	}
+}
+
+func TestGeminiProvider_StreamError(t *testing.T) {
+	p := newErrorProvider(t, 500, `{"error":{"code":500,"message":"Internal error","status":"INTERNAL"}}`)
+	stream, err := p.GenerateContentStream(context.Background(), "gemini-2.5-flash", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	_, err = stream.Next()
+	if !provider.IsRetryable(err) {
+		t.Fatalf("expected retryable error, got %v", err)
+	}
+}
+
+func TestGeminiProvider_Timeout(t *testing.T) {
+	p := newErrorProvider(t, 200, `{}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err := p.GenerateContent(ctx, "gemini-2.5-flash", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Kind != provider.ErrorKindTimeout {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
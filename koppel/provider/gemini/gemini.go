@@ -2,9 +2,15 @@ package gemini
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"iter"
+	"math"
+	"strings"
+	"time"
 
 	"google.golang.org/genai"
 	"gosuda.org/koppel/provider"
@@ -23,135 +29,333 @@ func NewProvider(ctx context.Context, config *genai.ClientConfig) (*GeminiProvid
 }
 
 func (p *GeminiProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
-	opts := &provider.Options{}
-	for _, o := range options {
-		if err := o(opts); err != nil {
-			return nil, err
-		}
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
-	config := &genai.GenerateContentConfig{}
-	if opts.CacheName != "" {
-		config.CachedContent = opts.CacheName
-	}
-	if len(opts.Tools) > 0 {
-		genaiTools := make([]*genai.Tool, len(opts.Tools))
-		for i, t := range opts.Tools {
-			genaiTools[i] = &genai.Tool{
-				FunctionDeclarations: []*genai.FunctionDeclaration{
-					{
-						Name:        t.Name,
-						Description: t.Description,
-						Parameters:  p.toGenAISchema(t.InputSchema),
-					},
-				},
-			}
-		}
-		config.Tools = genaiTools
+	config, err := p.toGenerateContentConfig(messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
 	contents := p.toGenAIContents(messages)
 	resp, err := p.client.Models.GenerateContent(ctx, model, contents, config)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &geminiResponse{resp: resp}, nil
 }
 
 func (p *GeminiProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
-	opts := &provider.Options{}
-	for _, o := range options {
-		if err := o(opts); err != nil {
-			return nil, err
-		}
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
-	config := &genai.GenerateContentConfig{}
+	config, err := p.toGenerateContentConfig(messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
+	}
+
+	contents := p.toGenAIContents(messages)
+	it := p.client.Models.GenerateContentStream(ctx, model, contents, config)
+	next, stop := iter.Pull2(it)
+	return &geminiStreamResponse{next: next, stop: stop}, nil
+}
+
+func (p *GeminiProvider) toGenerateContentConfig(messages []provider.Message, opts provider.Options) (*genai.GenerateContentConfig, error) {
+	config := &genai.GenerateContentConfig{
+		SystemInstruction: p.toSystemInstruction(messages, opts.SystemInstruction),
+	}
 	if opts.CacheName != "" {
+		// The system instruction and tools of a cached request are part of
+		// the cache itself and cannot be sent again.
+		if config.SystemInstruction != nil || len(opts.Tools) > 0 {
+			return nil, errors.New("system instruction and tools cannot be combined with a cache name")
+		}
 		config.CachedContent = opts.CacheName
 	}
 	if len(opts.Tools) > 0 {
 		genaiTools := make([]*genai.Tool, len(opts.Tools))
 		for i, t := range opts.Tools {
+			parameters, err := toGenAISchema(t.InputSchema)
+			if err != nil {
+				return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+			}
 			genaiTools[i] = &genai.Tool{
 				FunctionDeclarations: []*genai.FunctionDeclaration{
 					{
 						Name:        t.Name,
 						Description: t.Description,
-						Parameters:  p.toGenAISchema(t.InputSchema),
+						Parameters:  parameters,
 					},
 				},
 			}
 		}
 		config.Tools = genaiTools
 	}
+	if opts.Temperature != nil {
+		if *opts.Temperature > 2 {
+			return nil, fmt.Errorf("temperature must be at most 2, got %v", *opts.Temperature)
+		}
+		config.Temperature = genai.Ptr(float32(*opts.Temperature))
+	}
+	if opts.TopP != nil {
+		config.TopP = genai.Ptr(float32(*opts.TopP))
+	}
+	if opts.TopK != nil {
+		config.TopK = genai.Ptr(float32(*opts.TopK))
+	}
+	if opts.MaxOutputTokens > 0 {
+		if opts.MaxOutputTokens > math.MaxInt32 {
+			return nil, fmt.Errorf("max output tokens out of range: %d", opts.MaxOutputTokens)
+		}
+		config.MaxOutputTokens = int32(opts.MaxOutputTokens)
+	}
+	if len(opts.StopSequences) > 0 {
+		if len(opts.StopSequences) > 5 {
+			return nil, fmt.Errorf("at most 5 stop sequences are supported, got %d", len(opts.StopSequences))
+		}
+		config.StopSequences = opts.StopSequences
+	}
+	if opts.Seed != nil {
+		if *opts.Seed < math.MinInt32 || *opts.Seed > math.MaxInt32 {
+			return nil, fmt.Errorf("seed must fit in 32 bits, got %d", *opts.Seed)
+		}
+		config.Seed = genai.Ptr(int32(*opts.Seed))
+	}
+	if opts.ParallelToolCalls != nil && !*opts.ParallelToolCalls {
+		return nil, provider.UnsupportedOptionError(providerName, "disabling parallel tool calls")
+	}
+	if opts.ToolChoice != "" {
+		calling := &genai.FunctionCallingConfig{Mode: genai.FunctionCallingConfigModeAuto}
+		switch opts.ToolChoice {
+		case provider.ToolChoiceNone:
+			calling.Mode = genai.FunctionCallingConfigModeNone
+		case provider.ToolChoiceRequired:
+			calling.Mode = genai.FunctionCallingConfigModeAny
+		case provider.ToolChoiceTool:
+			calling.Mode = genai.FunctionCallingConfigModeAny
+			calling.AllowedFunctionNames = []string{opts.ToolName}
+		}
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: calling}
+	}
+	if opts.ResponseSchema != nil {
+		schema, err := toGenAISchema(opts.ResponseSchema.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("response schema: %w", err)
+		}
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = schema
+	}
+	return config, nil
+}
 
-	contents := p.toGenAIContents(messages)
-	it := p.client.Models.GenerateContentStream(ctx, model, contents, config)
-	next, stop := iter.Pull2(it)
-	return &geminiStreamResponse{next: next, stop: stop}, nil
+// toSystemInstruction collects the instruction option and any "system" role
+// messages, which Gemini only accepts outside of the conversation contents.
+func (p *GeminiProvider) toSystemInstruction(messages []provider.Message, instruction string) *genai.Content {
+	var parts []*genai.Part
+	if instruction != "" {
+		parts = append(parts, &genai.Part{Text: instruction})
+	}
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			continue
+		}
+		for _, part := range msg.Parts {
+			if t, ok := part.(provider.TextPart); ok {
+				parts = append(parts, &genai.Part{Text: string(t)})
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return &genai.Content{Parts: parts}
 }
 
-// ... (ContextCacher methods)
+func (p *GeminiProvider) CreateCache(ctx context.Context, model string, messages []provider.Message, displayName string, ttl time.Duration) (*provider.ContextCache, error) {
+	config := &genai.CreateCachedContentConfig{
+		TTL:               ttl,
+		DisplayName:       displayName,
+		Contents:          p.toGenAIContents(messages),
+		SystemInstruction: p.toSystemInstruction(messages, ""),
+	}
+	cc, err := p.client.Caches.Create(ctx, model, config)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	cache := toContextCache(cc)
+	if cache.ExpireTime.IsZero() && ttl > 0 {
+		cache.ExpireTime = time.Now().Add(ttl)
+	}
+	return cache, nil
+}
 
-func (p *GeminiProvider) toGenAISchema(schema interface{}) *genai.Schema {
-	if schema == nil {
-		return nil
+func (p *GeminiProvider) GetCache(ctx context.Context, name string) (*provider.ContextCache, error) {
+	cc, err := p.client.Caches.Get(ctx, name, nil)
+	if err != nil {
+		return nil, wrapError(err)
 	}
-	b, _ := json.Marshal(schema)
-	var s genai.Schema
-	json.Unmarshal(b, &s)
-	return &s
+	return toContextCache(cc), nil
 }
 
+func (p *GeminiProvider) DeleteCache(ctx context.Context, name string) error {
+	_, err := p.client.Caches.Delete(ctx, name, nil)
+	return wrapError(err)
+}
+
+func (p *GeminiProvider) ListCaches(ctx context.Context) ([]*provider.ContextCache, error) {
+	var caches []*provider.ContextCache
+	for cc, err := range p.client.Caches.All(ctx) {
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		caches = append(caches, toContextCache(cc))
+	}
+	return caches, nil
+}
+
+func toContextCache(cc *genai.CachedContent) *provider.ContextCache {
+	return &provider.ContextCache{
+		Name:        cc.Name,
+		DisplayName: cc.DisplayName,
+		Model:       cc.Model,
+		ExpireTime:  cc.ExpireTime,
+	}
+}
+
+// toGenAIContents converts messages to contents. Tool results without a
+// name take the name of the call they answer, since Gemini matches
+// responses to calls by name. A Gemini thought without text holds the
+// signature of a reply part and is sent back on the part that follows it.
 func (p *GeminiProvider) toGenAIContents(messages []provider.Message) []*genai.Content {
-	genaiContents := make([]*genai.Content, len(messages))
-	for i, msg := range messages {
-		genaiParts := make([]*genai.Part, len(msg.Parts))
-		for j, part := range msg.Parts {
+	genaiContents := make([]*genai.Content, 0, len(messages))
+	callNames := make(map[string]string)
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			continue
+		}
+		genaiParts := make([]*genai.Part, 0, len(msg.Parts))
+		var signature []byte
+		for _, part := range msg.Parts {
+			var genaiPart *genai.Part
 			switch v := part.(type) {
 			case provider.TextPart:
-				genaiParts[j] = &genai.Part{Text: string(v)}
+				genaiPart = &genai.Part{Text: string(v)}
 			case provider.BlobPart:
-				genaiParts[j] = &genai.Part{InlineData: &genai.Blob{
+				genaiPart = &genai.Part{InlineData: &genai.Blob{
 					MIMEType: v.MIMEType,
 					Data:     v.Data,
 				}}
 			case provider.ThoughtPart:
-				genaiParts[j] = &genai.Part{Thought: true, Text: string(v)}
+				// Redacted thoughts of other providers have no text to
+				// pass on; signatures are only sent back to Gemini.
+				if v.Redacted {
+					continue
+				}
+				if v.Provider == providerName && v.Text == "" {
+					signature = decodeSignature(v.Signature)
+					continue
+				}
+				genaiPart = &genai.Part{Thought: true, Text: v.Text}
+				if v.Provider == providerName {
+					genaiPart.ThoughtSignature = decodeSignature(v.Signature)
+				}
 			case provider.ToolCallPart:
 				var args map[string]interface{}
 				json.Unmarshal([]byte(v.Arguments), &args)
-				genaiParts[j] = &genai.Part{FunctionCall: &genai.FunctionCall{
+				genaiPart = &genai.Part{FunctionCall: &genai.FunctionCall{
+					ID:   apiCallID(v.ID),
 					Name: v.Name,
 					Args: args,
-				}}
+				}, ThoughtSignature: decodeSignature(v.ThoughtSignature)}
+				if v.ID != "" {
+					callNames[v.ID] = v.Name
+				}
 			case provider.ToolResultPart:
-				var response map[string]interface{}
-				if err := json.Unmarshal([]byte(v.Content), &response); err != nil {
-					response = map[string]interface{}{"result": v.Content}
+				if v.Name == "" {
+					v.Name = callNames[v.ID]
 				}
-				genaiParts[j] = &genai.Part{FunctionResponse: &genai.FunctionResponse{
-					Name:     v.Name,
-					Response: response,
-				}}
+				fr := toFunctionResponse(v)
+				fr.ID = apiCallID(v.ID)
+				genaiPart = &genai.Part{FunctionResponse: fr}
+			default:
+				continue
 			}
+			if signature != nil && genaiPart.ThoughtSignature == nil {
+				genaiPart.ThoughtSignature = signature
+				signature = nil
+			}
+			genaiParts = append(genaiParts, genaiPart)
 		}
 		// In Gemini, ToolResultPart must have role "user" or "function"
 		role := msg.Role
 		if role == "tool" {
 			role = "function"
 		}
-		genaiContents[i] = &genai.Content{
+		genaiContents = append(genaiContents, &genai.Content{
 			Role:  role,
 			Parts: genaiParts,
-		}
+		})
 	}
 	return genaiContents
 }
 
+// decodeSignature decodes a thought signature saved by encodeSignature.
+// Signatures that do not decode are left out rather than sent corrupted.
+func decodeSignature(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// encodeSignature encodes a thought signature for storage in a part.
+func encodeSignature(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// toFunctionResponse converts a tool result. A JSON object result is sent
+// as the response itself, other text under "result", or "error" for failed
+// calls; blobs are attached as function response parts.
+func toFunctionResponse(r provider.ToolResultPart) *genai.FunctionResponse {
+	text := r.Text()
+	var response map[string]interface{}
+	switch {
+	case r.IsError:
+		response = map[string]interface{}{"error": text}
+	case json.Unmarshal([]byte(text), &response) == nil && response != nil:
+	default:
+		response = map[string]interface{}{"result": text}
+	}
+
+	fr := &genai.FunctionResponse{Name: r.Name, Response: response}
+	for _, blob := range r.Blobs() {
+		fr.Parts = append(fr.Parts, &genai.FunctionResponsePart{
+			InlineData: &genai.FunctionResponseBlob{MIMEType: blob.MIMEType, Data: blob.Data},
+		})
+	}
+	return fr
+}
+
+// syntheticIDPrefix marks the tool call IDs made up for function calls the
+// API returned without one. They are not sent back to the API.
+const syntheticIDPrefix = "gemini_call_"
+
 type geminiResponse struct {
 	resp *genai.GenerateContentResponse
+	// callOffset numbers the synthesized IDs of a stream chunk after the
+	// function calls of earlier chunks.
+	callOffset int
 }
 
 func (r *geminiResponse) Text() string {
@@ -180,6 +384,32 @@ func (r *geminiResponse) Thought() string {
 	return thought
 }
 
+// ThoughtParts reports the thoughts of the reply. The signature Gemini
+// attaches to a text part is reported as a thought without text, since text
+// parts cannot carry one; function call signatures are on the tool calls.
+func (r *geminiResponse) ThoughtParts() []provider.ThoughtPart {
+	if r.resp == nil || len(r.resp.Candidates) == 0 || r.resp.Candidates[0].Content == nil {
+		return nil
+	}
+	var parts []provider.ThoughtPart
+	for _, part := range r.resp.Candidates[0].Content.Parts {
+		switch {
+		case part.Thought:
+			parts = append(parts, provider.ThoughtPart{
+				Text:      part.Text,
+				Signature: encodeSignature(part.ThoughtSignature),
+				Provider:  providerName,
+			})
+		case part.FunctionCall == nil && len(part.ThoughtSignature) > 0:
+			parts = append(parts, provider.ThoughtPart{
+				Signature: encodeSignature(part.ThoughtSignature),
+				Provider:  providerName,
+			})
+		}
+	}
+	return parts
+}
+
 func (r *geminiResponse) ToolCalls() []provider.ToolCallPart {
 	if r.resp == nil || len(r.resp.Candidates) == 0 || r.resp.Candidates[0].Content == nil {
 		return nil
@@ -188,29 +418,103 @@ func (r *geminiResponse) ToolCalls() []provider.ToolCallPart {
 	for _, part := range r.resp.Candidates[0].Content.Parts {
 		if part.FunctionCall != nil {
 			args, _ := json.Marshal(part.FunctionCall.Args)
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = syntheticCallID(r.resp.ResponseID, r.callOffset+len(calls))
+			}
 			calls = append(calls, provider.ToolCallPart{
-				Name:      part.FunctionCall.Name,
-				Arguments: string(args),
+				ID:               id,
+				Name:             part.FunctionCall.Name,
+				Arguments:        string(args),
+				ThoughtSignature: encodeSignature(part.ThoughtSignature),
 			})
 		}
 	}
 	return calls
 }
 
+// syntheticCallID returns a stable ID for the nth function call of a
+// response.
+func syntheticCallID(responseID string, n int) string {
+	if responseID == "" {
+		return fmt.Sprintf("%s%d", syntheticIDPrefix, n)
+	}
+	return fmt.Sprintf("%s%s_%d", syntheticIDPrefix, responseID, n)
+}
+
+// apiCallID returns the ID to send to the API for a tool call ID.
+func apiCallID(id string) string {
+	if strings.HasPrefix(id, syntheticIDPrefix) {
+		return ""
+	}
+	return id
+}
+
+func (r *geminiResponse) Usage() provider.Usage {
+	if r.resp == nil || r.resp.UsageMetadata == nil {
+		return provider.Usage{}
+	}
+	u := r.resp.UsageMetadata
+	return provider.Usage{
+		InputTokens:       int64(u.PromptTokenCount) + int64(u.ToolUsePromptTokenCount),
+		OutputTokens:      int64(u.CandidatesTokenCount) + int64(u.ThoughtsTokenCount),
+		ThinkingTokens:    int64(u.ThoughtsTokenCount),
+		CachedInputTokens: int64(u.CachedContentTokenCount),
+	}
+}
+
+func (r *geminiResponse) FinishReason() provider.FinishReason {
+	if r.resp == nil {
+		return provider.FinishReasonUnspecified
+	}
+	if len(r.resp.Candidates) == 0 {
+		if r.resp.PromptFeedback != nil && r.resp.PromptFeedback.BlockReason != "" {
+			return provider.FinishReasonContentFilter
+		}
+		return provider.FinishReasonUnspecified
+	}
+
+	switch r.resp.Candidates[0].FinishReason {
+	case "", genai.FinishReasonUnspecified:
+		return provider.FinishReasonUnspecified
+	case genai.FinishReasonStop:
+		// Gemini reports STOP for turns that end in function calls.
+		if len(r.ToolCalls()) > 0 {
+			return provider.FinishReasonToolCalls
+		}
+		return provider.FinishReasonStop
+	case genai.FinishReasonMaxTokens:
+		return provider.FinishReasonLength
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonBlocklist,
+		genai.FinishReasonProhibitedContent, genai.FinishReasonSPII, genai.FinishReasonImageSafety,
+		genai.FinishReasonImageProhibitedContent, genai.FinishReasonImageRecitation:
+		return provider.FinishReasonContentFilter
+	}
+	return provider.FinishReasonOther
+}
+
 type geminiStreamResponse struct {
 	next func() (*genai.GenerateContentResponse, error, bool)
 	stop func()
+	// calls counts the function calls of the chunks read so far.
+	calls int
 }
 
 func (s *geminiStreamResponse) Next() (provider.Response, error) {
 	resp, err, ok := s.next()
 	if !ok {
-		return nil, fmt.Errorf("no more stream items")
+		return nil, io.EOF
 	}
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
-	return &geminiResponse{resp: resp}, nil
+	r := &geminiResponse{resp: resp, callOffset: s.calls}
+	s.calls += len(r.ToolCalls())
+	return r, nil
+}
+
+func (s *geminiStreamResponse) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
 }
 
 func (s *geminiStreamResponse) Close() error {
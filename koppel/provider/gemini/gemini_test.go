@@ -1,9 +1,13 @@
 package gemini
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
+	"google.golang.org/genai"
 	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
 )
 
 func TestGeminiProvider_Interface(t *testing.T) {
@@ -39,3 +43,267 @@ func TestToGenAIContents(t *testing.T) {
 		t.Errorf("expected mimetype image/png, got %s", contents[0].Parts[1].InlineData.MIMEType)
 	}
 }
+
+func TestToFunctionResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		result provider.ToolResultPart
+		want   map[string]interface{}
+	}{
+		{"text", provider.ToolResultPart{Content: "sunny"}, map[string]interface{}{"result": "sunny"}},
+		{"object", provider.ToolResultPart{Parts: []provider.Part{provider.JSONPart(`{"temp":21}`)}}, map[string]interface{}{"temp": float64(21)}},
+		{"error", provider.ToolResultPart{Content: "boom", IsError: true}, map[string]interface{}{"error": "boom"}},
+	}
+	for _, tt := range tests {
+		fr := toFunctionResponse(tt.result)
+		if !reflect.DeepEqual(fr.Response, tt.want) {
+			t.Errorf("%s: response = %v, want %v", tt.name, fr.Response, tt.want)
+		}
+	}
+
+	fr := toFunctionResponse(provider.ToolResultPart{
+		Name:  "screenshot",
+		Parts: []provider.Part{provider.BlobPart{MIMEType: "image/png", Data: []byte("png")}},
+	})
+	if fr.Name != "screenshot" || len(fr.Parts) != 1 || fr.Parts[0].InlineData.MIMEType != "image/png" {
+		t.Errorf("expected the image as a response part, got %+v", fr)
+	}
+}
+
+func TestToGenerateContentConfig(t *testing.T) {
+	p := &GeminiProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTemperature(0.7),
+		provider.WithTopP(0.95),
+		provider.WithTopK(32),
+		provider.WithMaxOutputTokens(512),
+		provider.WithStopSequences("END"),
+		provider.WithSeed(7),
+		provider.WithSystemInstruction("be brief"),
+		provider.WithToolChoice(provider.ToolChoiceNone),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	messages := []provider.Message{
+		{Role: "system", Parts: []provider.Part{provider.TextPart("you are a helpful assistant")}},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hello")}},
+	}
+	config, err := p.toGenerateContentConfig(messages, opts)
+	if err != nil {
+		t.Fatalf("toGenerateContentConfig failed: %v", err)
+	}
+
+	if *config.Temperature != 0.7 || *config.TopP != 0.95 || *config.TopK != 32 {
+		t.Errorf("unexpected sampling config: %v, %v, %v", *config.Temperature, *config.TopP, *config.TopK)
+	}
+	if config.MaxOutputTokens != 512 || *config.Seed != 7 {
+		t.Errorf("unexpected max tokens or seed: %d, %d", config.MaxOutputTokens, *config.Seed)
+	}
+	if len(config.StopSequences) != 1 {
+		t.Errorf("unexpected stop sequences: %v", config.StopSequences)
+	}
+	if config.ToolConfig.FunctionCallingConfig.Mode != genai.FunctionCallingConfigModeNone {
+		t.Errorf("unexpected function calling mode: %s", config.ToolConfig.FunctionCallingConfig.Mode)
+	}
+	if config.SystemInstruction == nil || len(config.SystemInstruction.Parts) != 2 {
+		t.Fatalf("expected system instruction with 2 parts, got %+v", config.SystemInstruction)
+	}
+
+	contents := p.toGenAIContents(messages)
+	if len(contents) != 1 || contents[0].Role != "user" {
+		t.Errorf("expected system messages to be excluded from contents, got %d contents", len(contents))
+	}
+}
+
+func TestToGenerateContentConfig_ForcedTool(t *testing.T) {
+	p := &GeminiProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTools(tool.Definition{Name: "weather"}),
+		provider.WithForcedTool("weather"),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	config, err := p.toGenerateContentConfig(nil, opts)
+	if err != nil {
+		t.Fatalf("toGenerateContentConfig failed: %v", err)
+	}
+	calling := config.ToolConfig.FunctionCallingConfig
+	if calling.Mode != genai.FunctionCallingConfigModeAny || len(calling.AllowedFunctionNames) != 1 || calling.AllowedFunctionNames[0] != "weather" {
+		t.Errorf("expected the weather tool to be forced, got %+v", calling)
+	}
+
+	opts.ParallelToolCalls = genai.Ptr(false)
+	if _, err := p.toGenerateContentConfig(nil, opts); !errors.Is(err, provider.ErrUnsupportedOption) {
+		t.Errorf("expected ErrUnsupportedOption, got %v", err)
+	}
+}
+
+func TestToGenerateContentConfig_ResponseSchema(t *testing.T) {
+	p := &GeminiProvider{}
+	opts, err := provider.NewOptions(provider.WithResponseSchema("answer", map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+	}))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	config, err := p.toGenerateContentConfig(nil, opts)
+	if err != nil {
+		t.Fatalf("toGenerateContentConfig failed: %v", err)
+	}
+	if config.ResponseMIMEType != "application/json" {
+		t.Errorf("expected JSON MIME type, got %q", config.ResponseMIMEType)
+	}
+	if config.ResponseSchema == nil || config.ResponseSchema.Properties["city"] == nil {
+		t.Errorf("expected the response schema, got %+v", config.ResponseSchema)
+	}
+}
+
+func TestToGenerateContentConfig_CacheName(t *testing.T) {
+	p := &GeminiProvider{}
+	opts, err := provider.NewOptions(provider.WithCacheName("cachedContents/abc"))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	config, err := p.toGenerateContentConfig(nil, opts)
+	if err != nil {
+		t.Fatalf("toGenerateContentConfig failed: %v", err)
+	}
+	if config.CachedContent != "cachedContents/abc" {
+		t.Errorf("unexpected cached content: %s", config.CachedContent)
+	}
+
+	opts.SystemInstruction = "be brief"
+	if _, err := p.toGenerateContentConfig(nil, opts); err == nil {
+		t.Error("expected error combining cache name with a system instruction")
+	}
+}
+
+func TestGeminiResponse_Usage(t *testing.T) {
+	resp := &geminiResponse{
+		resp: &genai.GenerateContentResponse{
+			UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+				PromptTokenCount:        200,
+				CachedContentTokenCount: 150,
+				CandidatesTokenCount:    20,
+				ThoughtsTokenCount:      80,
+			},
+		},
+	}
+	want := provider.Usage{InputTokens: 200, OutputTokens: 100, ThinkingTokens: 80, CachedInputTokens: 150}
+	if got := resp.Usage(); got != want {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGeminiResponse_FinishReason(t *testing.T) {
+	candidate := func(reason genai.FinishReason, parts ...*genai.Part) *genai.GenerateContentResponse {
+		return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{
+			{FinishReason: reason, Content: &genai.Content{Parts: parts}},
+		}}
+	}
+	tests := []struct {
+		name string
+		resp *genai.GenerateContentResponse
+		want provider.FinishReason
+	}{
+		{"stop", candidate(genai.FinishReasonStop, &genai.Part{Text: "hi"}), provider.FinishReasonStop},
+		{"function call", candidate(genai.FinishReasonStop, &genai.Part{FunctionCall: &genai.FunctionCall{Name: "f"}}), provider.FinishReasonToolCalls},
+		{"max tokens", candidate(genai.FinishReasonMaxTokens), provider.FinishReasonLength},
+		{"safety", candidate(genai.FinishReasonSafety), provider.FinishReasonContentFilter},
+		{"malformed call", candidate(genai.FinishReasonMalformedFunctionCall), provider.FinishReasonOther},
+		{"stream chunk", candidate(""), provider.FinishReasonUnspecified},
+		{"blocked prompt", &genai.GenerateContentResponse{
+			PromptFeedback: &genai.GenerateContentResponsePromptFeedback{BlockReason: genai.BlockedReasonSafety},
+		}, provider.FinishReasonContentFilter},
+	}
+	for _, tt := range tests {
+		r := &geminiResponse{resp: tt.resp}
+		if got := r.FinishReason(); got != tt.want {
+			t.Errorf("%s: FinishReason() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGeminiResponse_ToolCallIDs(t *testing.T) {
+	call := func(id string) *genai.Part {
+		return &genai.Part{FunctionCall: &genai.FunctionCall{ID: id, Name: "weather", Args: map[string]any{"city": "Seoul"}}}
+	}
+	resp := &geminiResponse{resp: &genai.GenerateContentResponse{
+		ResponseID: "resp1",
+		Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []*genai.Part{call(""), call("fc_1"), call("")}}}},
+	}}
+
+	calls := resp.ToolCalls()
+	want := []string{"gemini_call_resp1_0", "fc_1", "gemini_call_resp1_2"}
+	for i, id := range want {
+		if calls[i].ID != id {
+			t.Errorf("call %d: ID = %q, want %q", i, calls[i].ID, id)
+		}
+	}
+	if again := resp.ToolCalls(); again[0].ID != calls[0].ID {
+		t.Error("expected synthesized IDs to be stable")
+	}
+}
+
+func TestGeminiStream_ToolCallIDs(t *testing.T) {
+	chunk := &genai.GenerateContentResponse{
+		ResponseID: "resp1",
+		Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []*genai.Part{
+			{FunctionCall: &genai.FunctionCall{Name: "weather"}},
+		}}}},
+	}
+	chunks := []*genai.GenerateContentResponse{chunk, chunk}
+	stream := &geminiStreamResponse{next: func() (*genai.GenerateContentResponse, error, bool) {
+		if len(chunks) == 0 {
+			return nil, nil, false
+		}
+		c := chunks[0]
+		chunks = chunks[1:]
+		return c, nil, true
+	}}
+
+	var ids []string
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, call := range resp.ToolCalls() {
+			ids = append(ids, call.ID)
+		}
+	}
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("expected distinct IDs across chunks, got %v", ids)
+	}
+}
+
+func TestToGenAIContents_ToolCallIDs(t *testing.T) {
+	p := &GeminiProvider{}
+	contents := p.toGenAIContents([]provider.Message{
+		{Role: "model", Parts: []provider.Part{
+			provider.ToolCallPart{ID: "fc_1", Name: "weather", Arguments: `{"city":"Seoul"}`},
+			provider.ToolCallPart{ID: "gemini_call_resp1_1", Name: "weather", Arguments: `{"city":"Busan"}`},
+		}},
+		{Role: "tool", Parts: []provider.Part{
+			provider.ToolResultPart{ID: "fc_1", Content: "sunny"},
+			provider.ToolResultPart{ID: "gemini_call_resp1_1", Name: "weather", Content: "rainy"},
+		}},
+	})
+
+	calls, results := contents[0].Parts, contents[1].Parts
+	if calls[0].FunctionCall.ID != "fc_1" || calls[1].FunctionCall.ID != "" {
+		t.Errorf("unexpected call IDs %q, %q", calls[0].FunctionCall.ID, calls[1].FunctionCall.ID)
+	}
+	if r := results[0].FunctionResponse; r.ID != "fc_1" || r.Name != "weather" {
+		t.Errorf("expected the result to take the call's name, got %+v", r)
+	}
+	if r := results[1].FunctionResponse; r.ID != "" || r.Name != "weather" {
+		t.Errorf("expected no ID for a synthesized call, got %+v", r)
+	}
+}
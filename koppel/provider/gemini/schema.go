@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+	"gosuda.org/koppel/tool"
+)
+
+// maxSchemaRecursion bounds how often a recursive schema definition is
+// inlined, since genai.Schema cannot express references.
+const maxSchemaRecursion = 3
+
+// schemaKeywords are the JSON Schema keywords genai.Schema can carry.
+var schemaKeywords = []string{
+	"anyOf", "default", "description", "enum", "example", "format", "items",
+	"maxItems", "maxLength", "maxProperties", "maximum", "minItems", "minLength",
+	"minProperties", "minimum", "nullable", "pattern", "properties",
+	"propertyOrdering", "required", "title", "type",
+}
+
+// schemaFormats are the formats Gemini accepts for each type.
+var schemaFormats = map[string][]string{
+	"STRING":  {"enum", "date-time"},
+	"INTEGER": {"int32", "int64"},
+	"NUMBER":  {"float", "double"},
+}
+
+// toGenAISchema converts a JSON Schema to the OpenAPI subset Gemini accepts.
+// References are inlined, nullable types and oneOf are rewritten, and
+// keywords Gemini rejects are dropped.
+func toGenAISchema(s interface{}) (*genai.Schema, error) {
+	schema, err := tool.NormalizeSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	if tool.HasRefs(schema) {
+		if schema, err = tool.InlineRefs(schema, maxSchemaRecursion); err != nil {
+			return nil, err
+		}
+	}
+
+	var walkErr error
+	tool.WalkSchema(schema, func(s map[string]interface{}) {
+		if err := sanitizeSchema(s); err != nil && walkErr == nil {
+			walkErr = err
+		}
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var out genai.Schema
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &out, nil
+}
+
+// sanitizeSchema rewrites a single schema, leaving its subschemas alone.
+func sanitizeSchema(s map[string]interface{}) error {
+	for _, key := range []string{"allOf", "not"} {
+		if _, ok := s[key]; ok {
+			return fmt.Errorf("%s is not supported", key)
+		}
+	}
+	if oneOf, ok := s["oneOf"]; ok {
+		if _, ok := s["anyOf"]; ok {
+			return fmt.Errorf("oneOf cannot be combined with anyOf")
+		}
+		s["anyOf"] = oneOf
+	}
+	if c, ok := s["const"]; ok {
+		s["enum"] = []interface{}{c}
+	}
+	if examples, ok := s["examples"].([]interface{}); ok && len(examples) > 0 {
+		s["example"] = examples[0]
+	}
+
+	// Gemini marks null as an option with nullable rather than a type.
+	types := tool.SchemaTypes(s)
+	if slices.Contains(types, "null") {
+		s["nullable"] = true
+		types = slices.DeleteFunc(types, func(t string) bool { return t == "null" })
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		s["anyOf"] = slices.DeleteFunc(anyOf, func(sub interface{}) bool {
+			m, ok := sub.(map[string]interface{})
+			if ok && len(m) == 1 && m["type"] == "null" {
+				s["nullable"] = true
+				return true
+			}
+			return false
+		})
+	}
+	switch len(types) {
+	case 0:
+		delete(s, "type")
+	case 1:
+		s["type"] = strings.ToUpper(types[0])
+	default:
+		if _, ok := s["anyOf"]; ok {
+			return fmt.Errorf("a list of types cannot be combined with anyOf")
+		}
+		var anyOf []interface{}
+		for _, t := range types {
+			anyOf = append(anyOf, map[string]interface{}{"type": t})
+		}
+		s["anyOf"] = anyOf
+		delete(s, "type")
+	}
+
+	typ, _ := s["type"].(string)
+	if enum, ok := s["enum"].([]interface{}); ok {
+		if typ == "" || typ == "STRING" {
+			// Gemini only accepts string enums.
+			values := make([]interface{}, len(enum))
+			for i, v := range enum {
+				values[i] = fmt.Sprint(v)
+			}
+			s["enum"] = values
+		} else {
+			var values []string
+			for _, v := range enum {
+				values = append(values, fmt.Sprint(v))
+			}
+			desc, _ := s["description"].(string)
+			s["description"] = strings.TrimSpace(desc + " Allowed values: " + strings.Join(values, ", ") + ".")
+			delete(s, "enum")
+		}
+	}
+	if format, ok := s["format"].(string); ok && !slices.Contains(schemaFormats[typ], format) {
+		delete(s, "format")
+	}
+
+	for key := range s {
+		if !slices.Contains(schemaKeywords, key) {
+			delete(s, key)
+		}
+	}
+	return nil
+}
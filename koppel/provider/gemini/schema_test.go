@@ -0,0 +1,108 @@
+package gemini
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/genai"
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+func TestToGenAISchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": ["string", "null"], "format": "email", "examples": ["a@b.c"]},
+			"level": {"type": "integer", "enum": [1, 2, 3], "description": "Level."},
+			"unit": {"const": "celsius"},
+			"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+			"when": {"oneOf": [{"type": "string", "format": "date-time"}, {"type": "null"}]}
+		},
+		"required": ["name"]
+	}`)
+
+	got, err := toGenAISchema(schema)
+	if err != nil {
+		t.Fatalf("toGenAISchema failed: %v", err)
+	}
+	want := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"name":  {Type: genai.TypeString, Nullable: genai.Ptr(true), Example: "a@b.c"},
+			"level": {Type: genai.TypeInteger, Description: "Level. Allowed values: 1, 2, 3."},
+			"unit":  {Enum: []string{"celsius"}},
+			"tags":  {Type: genai.TypeObject},
+			"when": {
+				Nullable: genai.Ptr(true),
+				AnyOf:    []*genai.Schema{{Type: genai.TypeString, Format: "date-time"}},
+			},
+		},
+		Required: []string{"name"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("toGenAISchema = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestToGenAISchema_Recursive(t *testing.T) {
+	type node struct {
+		Value    string `json:"value"`
+		Children []node `json:"children,omitempty"`
+	}
+	schema, err := tool.GenerateSchema(struct {
+		Root node `json:"root"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := toGenAISchema(schema)
+	if err != nil {
+		t.Fatalf("toGenAISchema failed: %v", err)
+	}
+	depth := 0
+	for n := s.Properties["root"]; n != nil; depth++ {
+		if children := n.Properties["children"]; children != nil {
+			n = children.Items
+		} else {
+			n = nil
+		}
+	}
+	if depth != maxSchemaRecursion {
+		t.Errorf("expected the recursion to be inlined %d times, got %d", maxSchemaRecursion, depth)
+	}
+}
+
+func TestToGenAISchema_Errors(t *testing.T) {
+	for name, schema := range map[string]interface{}{
+		"invalid JSON": json.RawMessage(`{"type":`),
+		"not object":   json.RawMessage(`[1, 2]`),
+		"allOf":        map[string]interface{}{"allOf": []interface{}{map[string]interface{}{"type": "string"}}},
+		"unknown ref":  map[string]interface{}{"$ref": "#/$defs/Missing"},
+		"unencodable":  map[string]interface{}{"type": func() {}},
+	} {
+		if _, err := toGenAISchema(schema); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestToGenerateContentConfig_InvalidToolSchema(t *testing.T) {
+	p := &GeminiProvider{}
+	opts, err := provider.NewOptions(provider.WithTools(tool.Definition{
+		Name:        "broken",
+		InputSchema: "not a schema",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.toGenerateContentConfig(nil, opts); err == nil {
+		t.Error("expected an error for an invalid tool schema")
+	}
+}
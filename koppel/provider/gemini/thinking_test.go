@@ -13,7 +13,7 @@ func TestGeminiProvider_Thinking(t *testing.T) {
 		{
 			Role: "user",
 			Parts: []provider.Part{
-				provider.ThoughtPart("I should say hello"),
+				provider.ThoughtPart{Text: "I should say hello"},
 				provider.TextPart("hello"),
 			},
 		},
@@ -57,3 +57,104 @@ func TestGeminiResponse_Thinking(t *testing.T) {
 		t.Errorf("expected thought 'Thinking...', got %s", resp.Thought())
 	}
 }
+
+func TestGeminiResponse_ThoughtSignatures(t *testing.T) {
+	resp := &geminiResponse{
+		resp: &genai.GenerateContentResponse{
+			Candidates: []*genai.Candidate{
+				{
+					Content: &genai.Content{
+						Parts: []*genai.Part{
+							{Thought: true, Text: "Thinking...", ThoughtSignature: []byte("sig-1")},
+							{FunctionCall: &genai.FunctionCall{ID: "call_1", Name: "weather"}, ThoughtSignature: []byte("sig-2")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	thoughts := resp.ThoughtParts()
+	want := provider.ThoughtPart{Text: "Thinking...", Signature: "c2lnLTE=", Provider: "gemini"}
+	if len(thoughts) != 1 || thoughts[0] != want {
+		t.Fatalf("ThoughtParts() = %+v, want [%+v]", thoughts, want)
+	}
+	calls := resp.ToolCalls()
+	if len(calls) != 1 || calls[0].ThoughtSignature != "c2lnLTI=" {
+		t.Fatalf("expected a signed tool call, got %+v", calls)
+	}
+
+	p := &GeminiProvider{}
+	contents := p.toGenAIContents([]provider.Message{{
+		Role:  "model",
+		Parts: []provider.Part{thoughts[0], calls[0]},
+	}})
+	parts := contents[0].Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if !parts[0].Thought || string(parts[0].ThoughtSignature) != "sig-1" {
+		t.Errorf("expected the thought signature to be sent back, got %+v", parts[0])
+	}
+	if parts[1].FunctionCall == nil || string(parts[1].ThoughtSignature) != "sig-2" {
+		t.Errorf("expected the call signature to be sent back, got %+v", parts[1])
+	}
+}
+
+func TestGeminiProvider_ForeignThoughts(t *testing.T) {
+	p := &GeminiProvider{}
+	contents := p.toGenAIContents([]provider.Message{{
+		Role: "model",
+		Parts: []provider.Part{
+			provider.ThoughtPart{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+			provider.ThoughtPart{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+			provider.TextPart("Hi"),
+		},
+	}})
+
+	parts := contents[0].Parts
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	if !parts[0].Thought || parts[0].Text != "Let me see." || parts[0].ThoughtSignature != nil {
+		t.Errorf("expected an unsigned thought, got %+v", parts[0])
+	}
+}
+
+func TestGeminiResponse_TextSignature(t *testing.T) {
+	resp := &geminiResponse{
+		resp: &genai.GenerateContentResponse{
+			Candidates: []*genai.Candidate{
+				{
+					Content: &genai.Content{
+						Parts: []*genai.Part{
+							{Text: "Hello!", ThoughtSignature: []byte("sig-1")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	thoughts := resp.ThoughtParts()
+	want := provider.ThoughtPart{Signature: "c2lnLTE=", Provider: "gemini"}
+	if len(thoughts) != 1 || thoughts[0] != want {
+		t.Fatalf("ThoughtParts() = %+v, want [%+v]", thoughts, want)
+	}
+	if resp.Thought() != "" {
+		t.Errorf("expected no thought text, got %q", resp.Thought())
+	}
+
+	p := &GeminiProvider{}
+	contents := p.toGenAIContents([]provider.Message{{
+		Role:  "model",
+		Parts: []provider.Part{thoughts[0], provider.TextPart(resp.Text())},
+	}})
+	parts := contents[0].Parts
+	if len(parts) != 1 {
+		t.Fatalf("expected 1 part, got %d", len(parts))
+	}
+	if parts[0].Thought || parts[0].Text != "Hello!" || string(parts[0].ThoughtSignature) != "sig-1" {
+		t.Errorf("expected the signature to be sent back on the text part, got %+v", parts[0])
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"gosuda.org/koppel/provider"
+)
+
+type callKey struct{}
+
+// call is the state the logging interceptor keeps for a call.
+type call struct {
+	start  time.Time
+	usage  provider.Usage
+	finish provider.FinishReason
+}
+
+// Logging returns an interceptor that logs every call with its model,
+// latency, finish reason and token usage. Message contents are not logged.
+func Logging(logger *slog.Logger) Interceptor {
+	return Interceptor{
+		Before: func(ctx context.Context, req *Request) (context.Context, error) {
+			return context.WithValue(ctx, callKey{}, &call{start: time.Now()}), nil
+		},
+		After: func(ctx context.Context, req *Request, resp provider.Response, err error) (provider.Response, error) {
+			c, _ := ctx.Value(callKey{}).(*call)
+			if c == nil {
+				return resp, err
+			}
+			if resp != nil {
+				c.usage = resp.Usage()
+				c.finish = resp.FinishReason()
+			}
+			logCall(ctx, logger, req, c, err)
+			return resp, err
+		},
+		OnChunk: func(ctx context.Context, req *Request, chunk provider.Response, err error) (provider.Response, error) {
+			c, _ := ctx.Value(callKey{}).(*call)
+			if c == nil {
+				return chunk, err
+			}
+			switch {
+			case err == nil:
+				if u := chunk.Usage(); !u.IsZero() {
+					c.usage = u
+				}
+				if f := chunk.FinishReason(); f != provider.FinishReasonUnspecified {
+					c.finish = f
+				}
+			case errors.Is(err, io.EOF):
+				logCall(ctx, logger, req, c, nil)
+			default:
+				logCall(ctx, logger, req, c, err)
+			}
+			return chunk, err
+		},
+	}
+}
+
+func logCall(ctx context.Context, logger *slog.Logger, req *Request, c *call, err error) {
+	attrs := []slog.Attr{
+		slog.String("model", req.Model),
+		slog.Bool("stream", req.Stream),
+		slog.Int("messages", len(req.Messages)),
+		slog.Duration("latency", time.Since(c.start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		logger.LogAttrs(ctx, slog.LevelError, "provider call failed", attrs...)
+		return
+	}
+	attrs = append(attrs,
+		slog.String("finish_reason", string(c.finish)),
+		slog.Int64("input_tokens", c.usage.InputTokens),
+		slog.Int64("output_tokens", c.usage.OutputTokens),
+	)
+	logger.LogAttrs(ctx, slog.LevelInfo, "provider call", attrs...)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	p := NewProvider(&recordingProvider{}, Logging(logger))
+
+	if _, err := p.GenerateContent(context.Background(), "m", userMessage("top secret")); err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	stream, err := p.GenerateContentStream(context.Background(), "m", userMessage("a b"))
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+
+	out := buf.String()
+	if strings.Count(out, `msg="provider call"`) != 2 {
+		t.Errorf("expected two call records, got:\n%s", out)
+	}
+	for _, want := range []string{"model=m", "stream=true", "finish_reason=stop", "input_tokens=3", "output_tokens=2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in log output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Error("expected message contents not to be logged")
+	}
+}
+
+func TestLogging_Error(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	p := NewProvider(&recordingProvider{err: errors.New("boom")}, Logging(logger))
+
+	if _, err := p.GenerateContent(context.Background(), "m", userMessage("hi")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(buf.String(), "level=ERROR") || !strings.Contains(buf.String(), "error=boom") {
+		t.Errorf("expected an error record, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,158 @@
+// Package middleware wraps a provider.Provider with interceptors that observe
+// and rewrite every call.
+package middleware
+
+import (
+	"context"
+	"iter"
+
+	"gosuda.org/koppel/provider"
+)
+
+// Request is a call as seen by interceptors. Before hooks may modify it;
+// the provider is called with the result. Messages and their parts are a
+// copy, so editing them in place leaves the caller's messages unchanged;
+// blob data is shared and must not be modified.
+type Request struct {
+	Model    string
+	Messages []provider.Message
+	Options  provider.Options
+	// Stream is set for GenerateContentStream calls.
+	Stream bool
+}
+
+// Interceptor hooks into provider calls. Any hook may be nil.
+type Interceptor struct {
+	// Before runs before the provider is called. The returned context is
+	// passed to the provider and to later hooks of the call, so it can carry
+	// per-call state. Returning an error aborts the call with that error.
+	Before func(ctx context.Context, req *Request) (context.Context, error)
+	// After runs when GenerateContent returns, or when GenerateContentStream
+	// fails to open a stream. It may replace the response or error.
+	After func(ctx context.Context, req *Request, resp provider.Response, err error) (provider.Response, error)
+	// OnChunk runs for every result of a stream's Next, including the final
+	// io.EOF. It may replace the chunk or error.
+	OnChunk func(ctx context.Context, req *Request, chunk provider.Response, err error) (provider.Response, error)
+}
+
+// MiddlewareProvider runs interceptors around the calls of a provider. Before
+// hooks run in order, After and OnChunk hooks in reverse order, so the first
+// interceptor sees the original request and the final response.
+type MiddlewareProvider struct {
+	provider     provider.Provider
+	interceptors []Interceptor
+}
+
+var _ provider.Provider = (*MiddlewareProvider)(nil)
+
+func NewProvider(p provider.Provider, interceptors ...Interceptor) *MiddlewareProvider {
+	return &MiddlewareProvider{provider: p, interceptors: interceptors}
+}
+
+func (p *MiddlewareProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	ctx, req, err := p.before(ctx, model, messages, options, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.provider.GenerateContent(ctx, req.Model, req.Messages, withOptions(req.Options))
+	return p.after(ctx, req, resp, err)
+}
+
+func (p *MiddlewareProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	ctx, req, err := p.before(ctx, model, messages, options, true)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := p.provider.GenerateContentStream(ctx, req.Model, req.Messages, withOptions(req.Options))
+	if err != nil {
+		_, err = p.after(ctx, req, nil, err)
+		return nil, err
+	}
+	return &middlewareStream{provider: p, ctx: ctx, req: req, stream: stream}, nil
+}
+
+func (p *MiddlewareProvider) before(ctx context.Context, model string, messages []provider.Message, options []provider.Option, stream bool) (context.Context, *Request, error) {
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return ctx, nil, err
+	}
+	req := &Request{Model: model, Messages: copyMessages(messages), Options: opts, Stream: stream}
+	for _, ic := range p.interceptors {
+		if ic.Before == nil {
+			continue
+		}
+		if ctx, err = ic.Before(ctx, req); err != nil {
+			return ctx, nil, err
+		}
+	}
+	return ctx, req, nil
+}
+
+func (p *MiddlewareProvider) after(ctx context.Context, req *Request, resp provider.Response, err error) (provider.Response, error) {
+	for i := len(p.interceptors) - 1; i >= 0; i-- {
+		if hook := p.interceptors[i].After; hook != nil {
+			resp, err = hook(ctx, req, resp, err)
+		}
+	}
+	return resp, err
+}
+
+func copyMessages(messages []provider.Message) []provider.Message {
+	if messages == nil {
+		return nil
+	}
+	out := make([]provider.Message, len(messages))
+	for i, msg := range messages {
+		msg.Parts = copyParts(msg.Parts)
+		out[i] = msg
+	}
+	return out
+}
+
+func copyParts(parts []provider.Part) []provider.Part {
+	if parts == nil {
+		return nil
+	}
+	out := make([]provider.Part, len(parts))
+	for i, part := range parts {
+		if r, ok := part.(provider.ToolResultPart); ok {
+			r.Parts = copyParts(r.Parts)
+			part = r
+		}
+		out[i] = part
+	}
+	return out
+}
+
+// withOptions passes options that were already resolved by the interceptors.
+func withOptions(opts provider.Options) provider.Option {
+	return func(o *provider.Options) error {
+		*o = opts
+		return nil
+	}
+}
+
+type middlewareStream struct {
+	provider *MiddlewareProvider
+	ctx      context.Context
+	req      *Request
+	stream   provider.StreamResponse
+}
+
+func (s *middlewareStream) Next() (provider.Response, error) {
+	chunk, err := s.stream.Next()
+	for i := len(s.provider.interceptors) - 1; i >= 0; i-- {
+		if hook := s.provider.interceptors[i].OnChunk; hook != nil {
+			chunk, err = hook(s.ctx, s.req, chunk, err)
+		}
+	}
+	return chunk, err
+}
+
+func (s *middlewareStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s *middlewareStream) Close() error {
+	return s.stream.Close()
+}
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"strings"
+	"testing"
+
+	"gosuda.org/koppel/provider"
+)
+
+type textResponse string
+
+func (r textResponse) Text() string                        { return string(r) }
+func (r textResponse) Thought() string                     { return "" }
+func (r textResponse) ToolCalls() []provider.ToolCallPart  { return nil }
+func (r textResponse) Usage() provider.Usage               { return provider.Usage{InputTokens: 3, OutputTokens: 2} }
+func (r textResponse) FinishReason() provider.FinishReason { return provider.FinishReasonStop }
+
+// recordingProvider records the request it receives and echoes the last
+// message's text.
+type recordingProvider struct {
+	model    string
+	messages []provider.Message
+	opts     provider.Options
+	err      error
+}
+
+func (p *recordingProvider) record(model string, messages []provider.Message, options []provider.Option) (string, error) {
+	p.model = model
+	p.messages = messages
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return "", err
+	}
+	p.opts = opts
+	if p.err != nil {
+		return "", p.err
+	}
+	last := messages[len(messages)-1]
+	return string(last.Parts[0].(provider.TextPart)), nil
+}
+
+func (p *recordingProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	text, err := p.record(model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+	return textResponse(text), nil
+}
+
+func (p *recordingProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	text, err := p.record(model, messages, options)
+	if err != nil {
+		return nil, err
+	}
+	return &wordStream{words: strings.Fields(text)}, nil
+}
+
+type wordStream struct {
+	words []string
+}
+
+func (s *wordStream) Next() (provider.Response, error) {
+	if len(s.words) == 0 {
+		return nil, io.EOF
+	}
+	w := s.words[0]
+	s.words = s.words[1:]
+	return textResponse(w), nil
+}
+
+func (s *wordStream) All() iter.Seq2[provider.Response, error] { return provider.Iterate(s) }
+func (s *wordStream) Close() error                             { return nil }
+
+func userMessage(text string) []provider.Message {
+	return []provider.Message{{Role: "user", Parts: []provider.Part{provider.TextPart(text)}}}
+}
+
+func TestMiddlewareProvider_Order(t *testing.T) {
+	var order []string
+	trace := func(name string) Interceptor {
+		return Interceptor{
+			Before: func(ctx context.Context, req *Request) (context.Context, error) {
+				order = append(order, "before "+name)
+				return ctx, nil
+			},
+			After: func(ctx context.Context, req *Request, resp provider.Response, err error) (provider.Response, error) {
+				order = append(order, "after "+name)
+				return resp, err
+			},
+		}
+	}
+	p := NewProvider(&recordingProvider{}, trace("a"), Interceptor{}, trace("b"))
+
+	if _, err := p.GenerateContent(context.Background(), "m", userMessage("hi")); err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	want := "before a,before b,after b,after a"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMiddlewareProvider_RewriteRequest(t *testing.T) {
+	inner := &recordingProvider{}
+	redact := Interceptor{
+		Before: func(ctx context.Context, req *Request) (context.Context, error) {
+			req.Model = "rewritten"
+			req.Messages = userMessage(strings.ReplaceAll(string(req.Messages[0].Parts[0].(provider.TextPart)), "secret", "[redacted]"))
+			req.Options.SystemInstruction = "be brief"
+			return ctx, nil
+		},
+	}
+	upper := Interceptor{
+		After: func(ctx context.Context, req *Request, resp provider.Response, err error) (provider.Response, error) {
+			return textResponse(strings.ToUpper(resp.Text())), err
+		},
+	}
+	p := NewProvider(inner, redact, upper)
+
+	resp, err := p.GenerateContent(context.Background(), "m", userMessage("my secret"), provider.WithTemperature(0.5))
+	if err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	if inner.model != "rewritten" {
+		t.Errorf("expected the rewritten model, got %q", inner.model)
+	}
+	if resp.Text() != "MY [REDACTED]" {
+		t.Errorf("unexpected response %q", resp.Text())
+	}
+	if inner.opts.SystemInstruction != "be brief" || inner.opts.Temperature == nil || *inner.opts.Temperature != 0.5 {
+		t.Errorf("expected rewritten options to keep the caller's settings, got %+v", inner.opts)
+	}
+}
+
+func TestMiddlewareProvider_CopiesMessages(t *testing.T) {
+	inner := &recordingProvider{}
+	redact := Interceptor{
+		Before: func(ctx context.Context, req *Request) (context.Context, error) {
+			req.Messages[1].Parts[0] = provider.TextPart("[redacted]")
+			result := req.Messages[0].Parts[0].(provider.ToolResultPart)
+			result.Parts[0] = provider.TextPart("[redacted]")
+			return ctx, nil
+		},
+	}
+	p := NewProvider(inner, redact)
+
+	messages := []provider.Message{
+		{Role: "tool", Parts: []provider.Part{provider.ToolResultPart{ID: "call_1", Parts: []provider.Part{provider.TextPart("secret")}}}},
+		{Role: "user", Parts: []provider.Part{provider.TextPart("my secret")}},
+	}
+	if _, err := p.GenerateContent(context.Background(), "m", messages); err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	if got := inner.messages[1].Parts[0]; got != provider.TextPart("[redacted]") {
+		t.Errorf("expected the provider to see the redacted message, got %v", got)
+	}
+	if got := messages[1].Parts[0]; got != provider.TextPart("my secret") {
+		t.Errorf("expected the caller's message to be unchanged, got %v", got)
+	}
+	if got := messages[0].Parts[0].(provider.ToolResultPart).Parts[0]; got != provider.TextPart("secret") {
+		t.Errorf("expected the caller's tool result to be unchanged, got %v", got)
+	}
+}
+
+func TestMiddlewareProvider_BeforeError(t *testing.T) {
+	inner := &recordingProvider{}
+	errBlocked := errors.New("blocked")
+	p := NewProvider(inner, Interceptor{
+		Before: func(ctx context.Context, req *Request) (context.Context, error) {
+			return ctx, errBlocked
+		},
+	})
+
+	if _, err := p.GenerateContent(context.Background(), "m", userMessage("hi")); !errors.Is(err, errBlocked) {
+		t.Fatalf("expected the interceptor error, got %v", err)
+	}
+	if inner.model != "" {
+		t.Error("expected the provider not to be called")
+	}
+}
+
+func TestMiddlewareProvider_Stream(t *testing.T) {
+	var chunks []string
+	var ended bool
+	p := NewProvider(&recordingProvider{}, Interceptor{
+		OnChunk: func(ctx context.Context, req *Request, chunk provider.Response, err error) (provider.Response, error) {
+			if !req.Stream {
+				t.Error("expected a stream request")
+			}
+			if errors.Is(err, io.EOF) {
+				ended = true
+				return chunk, err
+			}
+			chunks = append(chunks, chunk.Text())
+			return textResponse("<" + chunk.Text() + ">"), err
+		},
+	})
+
+	stream, err := p.GenerateContentStream(context.Background(), "m", userMessage("one two"))
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		text += resp.Text()
+	}
+	if text != "<one><two>" || len(chunks) != 2 || !ended {
+		t.Errorf("unexpected stream: text %q, chunks %v, ended %v", text, chunks, ended)
+	}
+}
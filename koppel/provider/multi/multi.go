@@ -0,0 +1,203 @@
+// Package multi composes several providers behind the provider.Provider
+// interface, either failing over between them or routing each request to one
+// of them by rule.
+package multi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+
+	"gosuda.org/koppel/provider"
+)
+
+// Target is a provider together with the model to request from it. If Model
+// is empty, the model passed by the caller is used.
+type Target struct {
+	Provider provider.Provider
+	Model    string
+}
+
+func (t Target) model(requested string) string {
+	if t.Model != "" {
+		return t.Model
+	}
+	return requested
+}
+
+type Options struct {
+	// FallbackIf decides whether an error moves on to the next target. By
+	// default every error does unless the context is done.
+	FallbackIf func(error) bool
+	// OnFallback is called with the failed target and its error before the
+	// next target is tried.
+	OnFallback func(Target, error)
+}
+
+type Option func(*Options) error
+
+// WithFallbackIf replaces the check that decides whether an error moves on
+// to the next target.
+func WithFallbackIf(fn func(error) bool) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("multi: fallback func must not be nil")
+		}
+		o.FallbackIf = fn
+		return nil
+	}
+}
+
+// WithOnFallback registers a callback invoked whenever a target fails and
+// the next one is tried.
+func WithOnFallback(fn func(Target, error)) Option {
+	return func(o *Options) error {
+		o.OnFallback = fn
+		return nil
+	}
+}
+
+// FallbackProvider sends each request to its targets in order until one
+// succeeds.
+type FallbackProvider struct {
+	targets []Target
+	opts    Options
+}
+
+var _ provider.Provider = (*FallbackProvider)(nil)
+
+func NewFallbackProvider(targets []Target, options ...Option) (*FallbackProvider, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("multi: at least one target is required")
+	}
+	for _, t := range targets {
+		if t.Provider == nil {
+			return nil, errors.New("multi: target provider must not be nil")
+		}
+	}
+	var opts Options
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+	return &FallbackProvider{targets: targets, opts: opts}, nil
+}
+
+// GenerateContent returns the first successful response. If every target
+// fails, the returned error joins the errors of all targets tried.
+func (p *FallbackProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	var errs []error
+	for i, t := range p.targets {
+		resp, err := t.Provider.GenerateContent(ctx, t.model(model), messages, options...)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+		if !p.fallback(ctx, i, err) {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// GenerateContentStream streams from the first target that opens a stream
+// and delivers its first chunk. Once a chunk has been delivered, errors are
+// returned without failing over.
+func (p *FallbackProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	s := &fallbackStream{
+		provider: p,
+		ctx:      ctx,
+		model:    model,
+		messages: messages,
+		options:  options,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fallback reports whether the target at index i failing with err should
+// move on to the next target.
+func (p *FallbackProvider) fallback(ctx context.Context, i int, err error) bool {
+	if i+1 >= len(p.targets) || ctx.Err() != nil {
+		return false
+	}
+	if p.opts.FallbackIf != nil && !p.opts.FallbackIf(err) {
+		return false
+	}
+	if p.opts.OnFallback != nil {
+		p.opts.OnFallback(p.targets[i], err)
+	}
+	return true
+}
+
+type fallbackStream struct {
+	provider *FallbackProvider
+	ctx      context.Context
+	model    string
+	messages []provider.Message
+	options  []provider.Option
+
+	stream    provider.StreamResponse
+	index     int
+	delivered bool
+	errs      []error
+}
+
+// open opens a stream on the current target, moving on to later targets
+// while opening fails.
+func (s *fallbackStream) open() error {
+	for {
+		t := s.provider.targets[s.index]
+		stream, err := t.Provider.GenerateContentStream(s.ctx, t.model(s.model), s.messages, s.options...)
+		if err == nil {
+			s.stream = stream
+			return nil
+		}
+		s.errs = append(s.errs, err)
+		if !s.provider.fallback(s.ctx, s.index, err) {
+			return errors.Join(s.errs...)
+		}
+		s.index++
+	}
+}
+
+func (s *fallbackStream) Next() (provider.Response, error) {
+	for {
+		if s.stream == nil {
+			return nil, errors.Join(s.errs...)
+		}
+		resp, err := s.stream.Next()
+		if err == nil {
+			s.delivered = true
+			return resp, nil
+		}
+		if s.delivered || errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		s.errs = append(s.errs, err)
+		s.stream.Close()
+		s.stream = nil
+		if !s.provider.fallback(s.ctx, s.index, err) {
+			return nil, errors.Join(s.errs...)
+		}
+		s.index++
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *fallbackStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s *fallbackStream) Close() error {
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.Close()
+}
@@ -0,0 +1,168 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"testing"
+
+	"gosuda.org/koppel/provider"
+)
+
+type textResponse string
+
+func (r textResponse) Text() string                        { return string(r) }
+func (r textResponse) Thought() string                     { return "" }
+func (r textResponse) ToolCalls() []provider.ToolCallPart  { return nil }
+func (r textResponse) Usage() provider.Usage               { return provider.Usage{} }
+func (r textResponse) FinishReason() provider.FinishReason { return provider.FinishReasonStop }
+
+// fakeProvider answers with its name and the requested model, or fails with
+// err. If streamErr is set, streams fail on their first Next.
+type fakeProvider struct {
+	name      string
+	err       error
+	streamErr error
+	models    []string
+}
+
+func (p *fakeProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	p.models = append(p.models, model)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return textResponse(p.name + ":" + model), nil
+}
+
+func (p *fakeProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	p.models = append(p.models, model)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &fakeStream{chunks: []string{p.name, ":" + model}, err: p.streamErr}, nil
+}
+
+type fakeStream struct {
+	chunks []string
+	err    error
+}
+
+func (s *fakeStream) Next() (provider.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return textResponse(chunk), nil
+}
+
+func (s *fakeStream) All() iter.Seq2[provider.Response, error] { return provider.Iterate(s) }
+func (s *fakeStream) Close() error                             { return nil }
+
+var errOverloaded = &provider.Error{Provider: "a", Kind: provider.ErrorKindOverloaded, StatusCode: 529}
+
+func TestFallbackProvider_GenerateContent(t *testing.T) {
+	a := &fakeProvider{name: "a", err: errOverloaded}
+	b := &fakeProvider{name: "b"}
+	var failed []Target
+	p, err := NewFallbackProvider([]Target{
+		{Provider: a, Model: "model-a"},
+		{Provider: b},
+	}, WithOnFallback(func(t Target, err error) { failed = append(failed, t) }))
+	if err != nil {
+		t.Fatalf("NewFallbackProvider failed: %v", err)
+	}
+
+	resp, err := p.GenerateContent(context.Background(), "requested", nil)
+	if err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	if resp.Text() != "b:requested" {
+		t.Errorf("expected the second target with the requested model, got %q", resp.Text())
+	}
+	if len(a.models) != 1 || a.models[0] != "model-a" {
+		t.Errorf("expected the first target to use its own model, got %v", a.models)
+	}
+	if len(failed) != 1 || failed[0].Provider != a {
+		t.Errorf("expected one fallback from a, got %v", failed)
+	}
+}
+
+func TestFallbackProvider_AllFail(t *testing.T) {
+	errAuth := &provider.Error{Provider: "b", Kind: provider.ErrorKindAuth}
+	p, err := NewFallbackProvider([]Target{
+		{Provider: &fakeProvider{name: "a", err: errOverloaded}},
+		{Provider: &fakeProvider{name: "b", err: errAuth}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.GenerateContent(context.Background(), "m", nil)
+	if !errors.Is(err, errOverloaded) || !errors.Is(err, errAuth) {
+		t.Fatalf("expected both errors to be joined, got %v", err)
+	}
+	var perr *provider.Error
+	if !errors.As(err, &perr) {
+		t.Error("expected errors.As to find a *provider.Error")
+	}
+}
+
+func TestFallbackProvider_FallbackIf(t *testing.T) {
+	b := &fakeProvider{name: "b"}
+	p, err := NewFallbackProvider([]Target{
+		{Provider: &fakeProvider{name: "a", err: errOverloaded}},
+		{Provider: b},
+	}, WithFallbackIf(func(error) bool { return false }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.GenerateContent(context.Background(), "m", nil); !errors.Is(err, errOverloaded) {
+		t.Fatalf("expected the first error, got %v", err)
+	}
+	if len(b.models) != 0 {
+		t.Error("expected the second target not to be called")
+	}
+}
+
+func TestFallbackProvider_Stream(t *testing.T) {
+	p, err := NewFallbackProvider([]Target{
+		{Provider: &fakeProvider{name: "a", err: errOverloaded}},
+		{Provider: &fakeProvider{name: "b", streamErr: errOverloaded}},
+		{Provider: &fakeProvider{name: "c"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := p.GenerateContentStream(context.Background(), "m", nil)
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		text += resp.Text()
+	}
+	if text != "c:m" {
+		t.Errorf("expected the third target, got %q", text)
+	}
+}
+
+func TestNewFallbackProvider_Invalid(t *testing.T) {
+	if _, err := NewFallbackProvider(nil); err == nil {
+		t.Error("expected an error for no targets")
+	}
+	if _, err := NewFallbackProvider([]Target{{Model: "m"}}); err == nil {
+		t.Error("expected an error for a nil provider")
+	}
+}
@@ -0,0 +1,127 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gosuda.org/koppel/provider"
+)
+
+// Request describes a call being routed.
+type Request struct {
+	Model    string
+	Messages []provider.Message
+	Options  provider.Options
+}
+
+// Rule reports whether a route applies to a request.
+type Rule func(Request) bool
+
+// Route sends requests matching Rule to Target.
+type Route struct {
+	Rule   Rule
+	Target Target
+}
+
+// RouterProvider sends each request to the target of the first route whose
+// rule matches, or to its default target if none does. A target may itself
+// be a FallbackProvider.
+type RouterProvider struct {
+	routes []Route
+	def    Target
+}
+
+var _ provider.Provider = (*RouterProvider)(nil)
+
+func NewRouterProvider(def Target, routes ...Route) (*RouterProvider, error) {
+	if def.Provider == nil {
+		return nil, errors.New("multi: default target provider must not be nil")
+	}
+	for _, r := range routes {
+		if r.Rule == nil || r.Target.Provider == nil {
+			return nil, errors.New("multi: route rule and provider must not be nil")
+		}
+	}
+	return &RouterProvider{routes: routes, def: def}, nil
+}
+
+func (p *RouterProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	t, err := p.Route(model, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+	return t.Provider.GenerateContent(ctx, t.model(model), messages, options...)
+}
+
+func (p *RouterProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	t, err := p.Route(model, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+	return t.Provider.GenerateContentStream(ctx, t.model(model), messages, options...)
+}
+
+// Route returns the target a request would be sent to.
+func (p *RouterProvider) Route(model string, messages []provider.Message, options ...provider.Option) (Target, error) {
+	opts, err := provider.NewOptions(options...)
+	if err != nil {
+		return Target{}, err
+	}
+	req := Request{Model: model, Messages: messages, Options: opts}
+	for _, r := range p.routes {
+		if r.Rule(req) {
+			return r.Target, nil
+		}
+	}
+	return p.def, nil
+}
+
+// HasImages matches requests with an image in any message.
+func HasImages() Rule {
+	return func(req Request) bool {
+		for _, msg := range req.Messages {
+			for _, part := range msg.Parts {
+				if b, ok := part.(provider.BlobPart); ok && strings.HasPrefix(b.MIMEType, "image/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// NeedsTools matches requests that make tools available to the model.
+func NeedsTools() Rule {
+	return func(req Request) bool {
+		return len(req.Options.Tools) > 0
+	}
+}
+
+// MinInputTokens matches requests whose estimated input is at least n tokens.
+func MinInputTokens(n int) Rule {
+	return func(req Request) bool {
+		return EstimateTokens(req) >= n
+	}
+}
+
+// EstimateTokens roughly estimates the input tokens of a request at four
+// characters per token. Blobs are not counted.
+func EstimateTokens(req Request) int {
+	chars := len(req.Options.SystemInstruction)
+	for _, msg := range req.Messages {
+		for _, part := range msg.Parts {
+			switch v := part.(type) {
+			case provider.TextPart:
+				chars += len(v)
+			case provider.ThoughtPart:
+				chars += len(v.Text)
+			case provider.ToolCallPart:
+				chars += len(v.Name) + len(v.Arguments)
+			case provider.ToolResultPart:
+				chars += len(v.Text())
+			}
+		}
+	}
+	return (chars + 3) / 4
+}
@@ -0,0 +1,77 @@
+package multi
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+func TestRouterProvider(t *testing.T) {
+	vision := &fakeProvider{name: "vision"}
+	tools := &fakeProvider{name: "tools"}
+	long := &fakeProvider{name: "long"}
+	def := &fakeProvider{name: "default"}
+
+	p, err := NewRouterProvider(Target{Provider: def},
+		Route{Rule: HasImages(), Target: Target{Provider: vision, Model: "vision-model"}},
+		Route{Rule: NeedsTools(), Target: Target{Provider: tools}},
+		Route{Rule: MinInputTokens(100), Target: Target{Provider: long}},
+	)
+	if err != nil {
+		t.Fatalf("NewRouterProvider failed: %v", err)
+	}
+
+	text := func(s string) []provider.Message {
+		return []provider.Message{{Role: "user", Parts: []provider.Part{provider.TextPart(s)}}}
+	}
+	image := []provider.Message{{Role: "user", Parts: []provider.Part{
+		provider.TextPart("what is this?"),
+		provider.BlobPart{MIMEType: "image/png", Data: []byte{0x89}},
+	}}}
+
+	tests := []struct {
+		name     string
+		messages []provider.Message
+		options  []provider.Option
+		want     string
+	}{
+		{"image", image, nil, "vision:vision-model"},
+		{"tools", text("hi"), []provider.Option{provider.WithTools(tool.Definition{Name: "search"})}, "tools:m"},
+		{"long", text(strings.Repeat("x", 400)), nil, "long:m"},
+		{"default", text("hi"), nil, "default:m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := p.GenerateContent(context.Background(), "m", tt.messages, tt.options...)
+			if err != nil {
+				t.Fatalf("GenerateContent failed: %v", err)
+			}
+			if resp.Text() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, resp.Text())
+			}
+		})
+	}
+}
+
+func TestRouterProvider_InvalidOption(t *testing.T) {
+	p, err := NewRouterProvider(Target{Provider: &fakeProvider{name: "default"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GenerateContent(context.Background(), "m", nil, provider.WithTopK(0)); err == nil {
+		t.Error("expected an invalid option to be rejected")
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	req := Request{
+		Messages: []provider.Message{{Role: "user", Parts: []provider.Part{provider.TextPart("12345678")}}},
+		Options:  provider.Options{SystemInstruction: "abcd"},
+	}
+	if got := EstimateTokens(req); got != 3 {
+		t.Errorf("expected 3 tokens, got %d", got)
+	}
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gosuda.org/koppel/tool"
+)
+
+// DefaultMaxObjectAttempts is the number of calls GenerateObject makes when
+// maxAttempts is zero.
+const DefaultMaxObjectAttempts = 3
+
+// ErrInvalidObject is returned by GenerateObject when no reply matched the
+// schema within the allowed attempts.
+var ErrInvalidObject = errors.New("reply does not match the response schema")
+
+// GenerateObject asks the model for a reply matching the JSON Schema derived
+// from T and decodes it. If T implements tool.Validator, the decoded value is
+// validated too. When decoding or validation fails, the reply and the error
+// are sent back so the model can correct itself, up to maxAttempts calls, or
+// DefaultMaxObjectAttempts if it is zero. The returned response is the last
+// one received.
+func GenerateObject[T any](ctx context.Context, p Provider, model string, messages []Message, maxAttempts int, options ...Option) (T, Response, error) {
+	var zero T
+	if maxAttempts < 0 {
+		return zero, nil, fmt.Errorf("max attempts must not be negative, got %d", maxAttempts)
+	}
+	if maxAttempts == 0 {
+		maxAttempts = DefaultMaxObjectAttempts
+	}
+	schema, err := tool.GenerateSchema(zero)
+	if err != nil {
+		return zero, nil, err
+	}
+	opts, err := NewOptions(options...)
+	if err != nil {
+		return zero, nil, err
+	}
+	if opts.ResponseSchema == nil {
+		options = append(options, WithResponseSchema(schemaName(reflect.TypeFor[T]()), schema))
+	}
+
+	messages = messages[:len(messages):len(messages)]
+	for attempt := 1; ; attempt++ {
+		resp, err := p.GenerateContent(ctx, model, messages, options...)
+		if err != nil {
+			return zero, nil, err
+		}
+
+		var v T
+		text := trimCodeFence(resp.Text())
+		err = tool.DecodeArguments(text, schema, &v)
+		if err == nil {
+			return v, resp, nil
+		}
+		if attempt >= maxAttempts {
+			return zero, resp, fmt.Errorf("%w: %v", ErrInvalidObject, err)
+		}
+		messages = append(messages,
+			Message{Role: "model", Parts: []Part{TextPart(resp.Text())}},
+			Message{Role: "user", Parts: []Part{TextPart(fmt.Sprintf(
+				"The reply is not valid: %v. Reply again with only a JSON document that matches the schema.", err))}},
+		)
+	}
+}
+
+// schemaName derives a response schema name from the name of t.
+func schemaName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	if name == "" {
+		return "response"
+	}
+	return name[:min(len(name), 64)]
+}
+
+// trimCodeFence removes a Markdown code fence some models wrap JSON in.
+func trimCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
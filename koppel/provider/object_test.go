@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type city struct {
+	Name       string `json:"name"`
+	Population int    `json:"population"`
+}
+
+func (c *city) Validate() error {
+	if c.Population < 0 {
+		return errors.New("population must not be negative")
+	}
+	return nil
+}
+
+// replyProvider answers with replies in order and records each request.
+type replyProvider struct {
+	replies  []string
+	requests [][]Message
+	opts     []Options
+}
+
+func (p *replyProvider) GenerateContent(ctx context.Context, model string, messages []Message, options ...Option) (Response, error) {
+	opts, err := NewOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+	p.requests = append(p.requests, messages)
+	p.opts = append(p.opts, opts)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return textResponse(reply), nil
+}
+
+func (p *replyProvider) GenerateContentStream(ctx context.Context, model string, messages []Message, options ...Option) (StreamResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestGenerateObject(t *testing.T) {
+	p := &replyProvider{replies: []string{
+		`{"name":"Seoul"}`,
+		`{"name":"Seoul","population":-1}`,
+		"```json\n{\"name\":\"Seoul\",\"population\":9500000}\n```",
+	}}
+	messages := []Message{{Role: "user", Parts: []Part{TextPart("largest city in Korea?")}}}
+
+	got, resp, err := GenerateObject[city](context.Background(), p, "model", messages, 0)
+	if err != nil {
+		t.Fatalf("GenerateObject failed: %v", err)
+	}
+	if got != (city{Name: "Seoul", Population: 9500000}) || resp == nil {
+		t.Errorf("unexpected object %+v", got)
+	}
+
+	rs := p.opts[0].ResponseSchema
+	if rs == nil || rs.Name != "city" {
+		t.Fatalf("expected a response schema named after the type, got %+v", rs)
+	}
+	if len(p.requests[1]) != 3 || len(p.requests[2]) != 5 {
+		t.Fatalf("expected each retry to add the reply and the error, got %d and %d messages", len(p.requests[1]), len(p.requests[2]))
+	}
+	feedback := string(p.requests[1][2].Parts[0].(TextPart))
+	if !strings.Contains(feedback, `"population"`) {
+		t.Errorf("expected the error to be sent back, got %q", feedback)
+	}
+	if !strings.Contains(string(p.requests[2][4].Parts[0].(TextPart)), "must not be negative") {
+		t.Errorf("expected the validation error to be sent back")
+	}
+	if len(messages) != 1 {
+		t.Error("expected the caller's messages to be left untouched")
+	}
+}
+
+func TestGenerateObject_Exhausted(t *testing.T) {
+	p := &replyProvider{replies: []string{"not json", "still not json"}}
+
+	_, resp, err := GenerateObject[city](context.Background(), p, "model", nil, 2)
+	if !errors.Is(err, ErrInvalidObject) {
+		t.Fatalf("expected ErrInvalidObject, got %v", err)
+	}
+	if resp == nil || resp.Text() != "still not json" {
+		t.Errorf("expected the last response, got %v", resp)
+	}
+
+	if _, _, err := GenerateObject[city](context.Background(), p, "model", nil, -1); err == nil {
+		t.Error("expected an error for negative attempts")
+	}
+}
+
+func TestTrimCodeFence(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"a":1}`:                 `{"a":1}`,
+		"```json\n{\"a\":1}\n```": `{"a":1}`,
+		"```\n{\"a\":1}```":       `{"a":1}`,
+	} {
+		if got := trimCodeFence(in); got != want {
+			t.Errorf("trimCodeFence(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/openai/openai-go/v3"
+	"gosuda.org/koppel/provider"
+)
+
+const providerName = "openai"
+
+// wrapError converts errors returned by the OpenAI client into a
+// *provider.Error.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *provider.Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		e := &provider.Error{
+			Provider:   providerName,
+			Kind:       provider.KindFromStatus(apiErr.StatusCode),
+			StatusCode: apiErr.StatusCode,
+			Message:    apiErr.Message,
+			Err:        err,
+		}
+		if apiErr.Response != nil {
+			e.RetryAfter = provider.ParseRetryAfter(apiErr.Response.Header)
+		}
+		switch {
+		case apiErr.Code == "context_length_exceeded" || provider.IsContextLengthMessage(apiErr.Message):
+			e.Kind = provider.ErrorKindContextLength
+		case apiErr.Code == "content_filter" || apiErr.Code == "content_policy_violation":
+			e.Kind = provider.ErrorKindContentFiltered
+		case apiErr.Code == "insufficient_quota":
+			// Quota exhaustion is reported as 429 but does not clear by waiting.
+			e.Kind = provider.ErrorKindAuth
+		}
+		return e
+	}
+	if e := provider.TransportError(providerName, err); e != nil {
+		return e
+	}
+	return &provider.Error{Provider: providerName, Kind: provider.ErrorKindUnknown, Err: err}
+}
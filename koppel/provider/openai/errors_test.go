@@ -0,0 +1,126 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"gosuda.org/koppel/provider"
+)
+
+func newErrorProvider(t *testing.T, status int, header http.Header, body string) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"), option.WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+func TestOpenAIProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		kind       provider.ErrorKind
+		retryAfter time.Duration
+	}{
+		{
+			name:       "rate limited",
+			status:     429,
+			header:     http.Header{"Retry-After-Ms": {"250"}},
+			body:       `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			kind:       provider.ErrorKindRateLimited,
+			retryAfter: 250 * time.Millisecond,
+		},
+		{
+			name:   "quota",
+			status: 429,
+			body:   `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`,
+			kind:   provider.ErrorKindAuth,
+		},
+		{
+			name:   "auth",
+			status: 401,
+			body:   `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`,
+			kind:   provider.ErrorKindAuth,
+		},
+		{
+			name:   "context length",
+			status: 400,
+			body:   `{"error":{"message":"This model's maximum context length is 128000 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`,
+			kind:   provider.ErrorKindContextLength,
+		},
+		{
+			name:   "server",
+			status: 500,
+			body:   `{"error":{"message":"The server had an error","type":"server_error"}}`,
+			kind:   provider.ErrorKindServer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newErrorProvider(t, tt.status, tt.header, tt.body)
+			_, err := p.GenerateContent(context.Background(), "gpt-4o", []provider.Message{
+				{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+			})
+
+			var perr *provider.Error
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected *provider.Error, got %T: %v", err, err)
+			}
+			if perr.Provider != "openai" || perr.Kind != tt.kind || perr.StatusCode != tt.status {
+				t.Errorf("unexpected error: %+v", perr)
+			}
+			if perr.RetryAfter != tt.retryAfter {
+				t.Errorf("expected retry after %v, got %v", tt.retryAfter, perr.RetryAfter)
+			}
+			var apiErr *openai.Error
+			if !errors.As(err, &apiErr) {
+				t.Error("expected the SDK error to be reachable")
+			}
+		})
+	}
+}
+
+func TestOpenAIProvider_StreamError(t *testing.T) {
+	p := newErrorProvider(t, 503, nil, `{"error":{"message":"overloaded","type":"server_error"}}`)
+	stream, err := p.GenerateContentStream(context.Background(), "gpt-4o", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	_, err = stream.Next()
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Kind != provider.ErrorKindOverloaded || !perr.Retryable() {
+		t.Fatalf("expected retryable overloaded error, got %v", err)
+	}
+}
+
+func TestOpenAIProvider_InvalidOptionError(t *testing.T) {
+	p := newErrorProvider(t, 200, nil, `{}`)
+	_, err := p.GenerateContent(context.Background(), "gpt-4o", nil, provider.WithTemperature(3))
+	var perr *provider.Error
+	if !errors.As(err, &perr) || perr.Kind != provider.ErrorKindInvalidRequest {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"iter"
+	"strings"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
@@ -26,25 +29,17 @@ func NewProvider(ctx context.Context, options ...option.RequestOption) (*OpenAIP
 func (p *OpenAIProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
 	opts, err := provider.NewOptions(options...)
 	if err != nil {
-		return nil, err
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
-	params := p.toChatParams(model, messages)
-	if len(opts.Tools) > 0 {
-		tools := make([]openai.ChatCompletionToolUnionParam, len(opts.Tools))
-		for i, t := range opts.Tools {
-			tools[i] = openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
-				Name:        t.Name,
-				Description: param.NewOpt(t.Description),
-				Parameters:  shared.FunctionParameters(t.InputSchema.(map[string]interface{})),
-			})
-		}
-		params.Tools = tools
+	params, err := p.toChatParams(model, messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
 	resp, err := p.client.Chat.Completions.New(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return &openaiResponse{resp: resp}, nil
 }
@@ -52,28 +47,32 @@ func (p *OpenAIProvider) GenerateContent(ctx context.Context, model string, mess
 func (p *OpenAIProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
 	opts, err := provider.NewOptions(options...)
 	if err != nil {
-		return nil, err
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
-	params := p.toChatParams(model, messages)
-	if len(opts.Tools) > 0 {
-		tools := make([]openai.ChatCompletionToolUnionParam, len(opts.Tools))
-		for i, t := range opts.Tools {
-			tools[i] = openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
-				Name:        t.Name,
-				Description: param.NewOpt(t.Description),
-				Parameters:  shared.FunctionParameters(t.InputSchema.(map[string]interface{})),
-			})
-		}
-		params.Tools = tools
+	params, err := p.toChatParams(model, messages, opts)
+	if err != nil {
+		return nil, provider.InvalidRequestError(providerName, err)
 	}
 
+	params.StreamOptions.IncludeUsage = param.NewOpt(true)
+
 	stream := p.client.Chat.Completions.NewStreaming(ctx, params)
 	return &openaiStreamResponse{stream: stream}, nil
 }
 
-func (p *OpenAIProvider) toChatParams(model string, messages []provider.Message) openai.ChatCompletionNewParams {
+func (p *OpenAIProvider) toChatParams(model string, messages []provider.Message, opts provider.Options) (openai.ChatCompletionNewParams, error) {
 	var openaiMessages []openai.ChatCompletionMessageParamUnion
+	if opts.SystemInstruction != "" {
+		openaiMessages = append(openaiMessages, openai.ChatCompletionMessageParamUnion{
+			OfSystem: &openai.ChatCompletionSystemMessageParam{
+				Content: openai.ChatCompletionSystemMessageParamContentUnion{
+					OfString: param.NewOpt(opts.SystemInstruction),
+				},
+				Role: constant.System("system"),
+			},
+		})
+	}
 	for _, msg := range messages {
 		role := msg.Role
 		if role == "model" {
@@ -147,14 +146,7 @@ func (p *OpenAIProvider) toChatParams(model string, messages []provider.Message)
 						},
 					})
 				case provider.BlobPart:
-					parts = append(parts, openai.ChatCompletionContentPartUnionParam{
-						OfImageURL: &openai.ChatCompletionContentPartImageParam{
-							ImageURL: openai.ChatCompletionContentPartImageImageURLParam{
-								URL: fmt.Sprintf("data:%s;base64,%s", v.MIMEType, base64.StdEncoding.EncodeToString(v.Data)),
-							},
-							Type: constant.ImageURL("image_url"),
-						},
-					})
+					parts = append(parts, imagePart(v))
 				}
 			}
 			openaiMessages = append(openaiMessages, openai.ChatCompletionMessageParamUnion{
@@ -167,24 +159,149 @@ func (p *OpenAIProvider) toChatParams(model string, messages []provider.Message)
 			})
 
 		case "tool":
+			// Tool messages carry text only, so images returned by tools
+			// follow the results in a user message, and failures are
+			// marked in the text.
+			var images []openai.ChatCompletionContentPartUnionParam
 			for _, part := range msg.Parts {
 				if v, ok := part.(provider.ToolResultPart); ok {
+					content := v.Text()
+					if v.IsError {
+						content = "error: " + content
+					}
+					for _, blob := range v.Blobs() {
+						if strings.HasPrefix(blob.MIMEType, "image/") {
+							images = append(images, openai.ChatCompletionContentPartUnionParam{
+								OfText: &openai.ChatCompletionContentPartTextParam{
+									Text: fmt.Sprintf("Image returned by %s (call %s):", v.Name, v.ID),
+									Type: constant.Text("text"),
+								},
+							}, imagePart(blob))
+							continue
+						}
+						content += fmt.Sprintf("\n[%s attachment of %d bytes omitted]", blob.MIMEType, len(blob.Data))
+					}
 					openaiMessages = append(openaiMessages, openai.ChatCompletionMessageParamUnion{
 						OfTool: &openai.ChatCompletionToolMessageParam{
-							Content:    openai.ChatCompletionToolMessageParamContentUnion{OfString: param.NewOpt(v.Content)},
+							Content:    openai.ChatCompletionToolMessageParamContentUnion{OfString: param.NewOpt(content)},
 							ToolCallID: v.ID,
 							Role:       constant.Tool("tool"),
 						},
 					})
 				}
 			}
+			if len(images) > 0 {
+				openaiMessages = append(openaiMessages, openai.ChatCompletionMessageParamUnion{
+					OfUser: &openai.ChatCompletionUserMessageParam{
+						Content: openai.ChatCompletionUserMessageParamContentUnion{
+							OfArrayOfContentParts: images,
+						},
+						Role: constant.User("user"),
+					},
+				})
+			}
 		}
 	}
 
-	return openai.ChatCompletionNewParams{
+	params := openai.ChatCompletionNewParams{
 		Model:    shared.ChatModel(model),
 		Messages: openaiMessages,
 	}
+	err := p.applyOptions(&params, opts)
+	return params, err
+}
+
+func imagePart(blob provider.BlobPart) openai.ChatCompletionContentPartUnionParam {
+	return openai.ChatCompletionContentPartUnionParam{
+		OfImageURL: &openai.ChatCompletionContentPartImageParam{
+			ImageURL: openai.ChatCompletionContentPartImageImageURLParam{
+				URL: fmt.Sprintf("data:%s;base64,%s", blob.MIMEType, base64.StdEncoding.EncodeToString(blob.Data)),
+			},
+			Type: constant.ImageURL("image_url"),
+		},
+	}
+}
+
+func (p *OpenAIProvider) applyOptions(params *openai.ChatCompletionNewParams, opts provider.Options) error {
+	if opts.CacheName != "" {
+		return provider.UnsupportedOptionError(providerName, "cache name")
+	}
+	if opts.TopK != nil {
+		return provider.UnsupportedOptionError(providerName, "top-k")
+	}
+
+	if len(opts.Tools) > 0 {
+		tools := make([]openai.ChatCompletionToolUnionParam, len(opts.Tools))
+		for i, t := range opts.Tools {
+			parameters, strict, err := toParameters(t.InputSchema)
+			if err != nil {
+				return fmt.Errorf("tool %s: %w", t.Name, err)
+			}
+			tools[i] = openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+				Name:        t.Name,
+				Description: param.NewOpt(t.Description),
+				Parameters:  shared.FunctionParameters(parameters),
+				Strict:      param.NewOpt(strict),
+			})
+		}
+		params.Tools = tools
+	}
+	if opts.Temperature != nil {
+		if *opts.Temperature > 2 {
+			return fmt.Errorf("temperature must be at most 2, got %v", *opts.Temperature)
+		}
+		params.Temperature = param.NewOpt(*opts.Temperature)
+	}
+	if opts.TopP != nil {
+		params.TopP = param.NewOpt(*opts.TopP)
+	}
+	if opts.MaxOutputTokens > 0 {
+		params.MaxCompletionTokens = param.NewOpt(int64(opts.MaxOutputTokens))
+	}
+	if len(opts.StopSequences) > 0 {
+		if len(opts.StopSequences) > 4 {
+			return fmt.Errorf("at most 4 stop sequences are supported, got %d", len(opts.StopSequences))
+		}
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: opts.StopSequences}
+	}
+	if opts.Seed != nil {
+		params.Seed = param.NewOpt(*opts.Seed)
+	}
+	switch opts.ToolChoice {
+	case "":
+	case provider.ToolChoiceTool:
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfFunctionToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: opts.ToolName},
+			},
+		}
+	default:
+		params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfAuto: param.NewOpt(string(opts.ToolChoice)),
+		}
+	}
+	// The API rejects parallel_tool_calls on requests without tools.
+	if opts.ParallelToolCalls != nil && len(opts.Tools) > 0 {
+		params.ParallelToolCalls = param.NewOpt(*opts.ParallelToolCalls)
+	}
+	if rs := opts.ResponseSchema; rs != nil {
+		schema, strict, err := toParameters(rs.Schema)
+		if err != nil {
+			return fmt.Errorf("response schema: %w", err)
+		}
+		jsonSchema := shared.ResponseFormatJSONSchemaJSONSchemaParam{
+			Name:   rs.Name,
+			Schema: schema,
+			Strict: param.NewOpt(strict),
+		}
+		if rs.Description != "" {
+			jsonSchema.Description = param.NewOpt(rs.Description)
+		}
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{JSONSchema: jsonSchema},
+		}
+	}
+	return nil
 }
 
 type openaiResponse struct {
@@ -217,19 +334,79 @@ func (r *openaiResponse) ToolCalls() []provider.ToolCallPart {
 	return calls
 }
 
+func (r *openaiResponse) Usage() provider.Usage {
+	if r.resp == nil {
+		return provider.Usage{}
+	}
+	return toUsage(r.resp.Usage)
+}
+
+func (r *openaiResponse) FinishReason() provider.FinishReason {
+	if r.resp == nil || len(r.resp.Choices) == 0 {
+		return provider.FinishReasonUnspecified
+	}
+	return toFinishReason(r.resp.Choices[0].FinishReason)
+}
+
+func toFinishReason(reason string) provider.FinishReason {
+	switch reason {
+	case "":
+		return provider.FinishReasonUnspecified
+	case "stop":
+		return provider.FinishReasonStop
+	case "length":
+		return provider.FinishReasonLength
+	case "tool_calls", "function_call":
+		return provider.FinishReasonToolCalls
+	case "content_filter":
+		return provider.FinishReasonContentFilter
+	}
+	return provider.FinishReasonOther
+}
+
+func toUsage(u openai.CompletionUsage) provider.Usage {
+	return provider.Usage{
+		InputTokens:       u.PromptTokens,
+		OutputTokens:      u.CompletionTokens,
+		ThinkingTokens:    u.CompletionTokensDetails.ReasoningTokens,
+		CachedInputTokens: u.PromptTokensDetails.CachedTokens,
+	}
+}
+
 type openaiStreamResponse struct {
 	stream *ssestream.Stream[openai.ChatCompletionChunk]
+	calls  provider.ToolCallAccumulator
 }
 
+// Next returns the next chunk. Tool call fragments are buffered and the
+// complete calls are reported by the chunk that carries the finish reason.
 func (s *openaiStreamResponse) Next() (provider.Response, error) {
 	if !s.stream.Next() {
 		if err := s.stream.Err(); err != nil {
-			return nil, err
+			return nil, wrapError(err)
+		}
+		if s.calls.Pending() {
+			// The stream ended without a finish reason; report the
+			// buffered calls in a final synthetic chunk.
+			return &openaiChunkResponse{calls: s.calls.Flush()}, nil
 		}
-		return nil, fmt.Errorf("no more stream items")
+		return nil, io.EOF
 	}
 	chunk := s.stream.Current()
-	return &openaiChunkResponse{chunk: chunk}, nil
+	resp := &openaiChunkResponse{chunk: chunk}
+	if len(chunk.Choices) > 0 {
+		for _, call := range chunk.Choices[0].Delta.ToolCalls {
+			s.calls.Add(int(call.Index), call.ID, call.Function.Name, call.Function.Arguments)
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			resp.calls = s.calls.Flush()
+		}
+	}
+	return resp, nil
+}
+
+func (s *openaiStreamResponse) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
 }
 
 func (s *openaiStreamResponse) Close() error {
@@ -238,6 +415,7 @@ func (s *openaiStreamResponse) Close() error {
 
 type openaiChunkResponse struct {
 	chunk openai.ChatCompletionChunk
+	calls []provider.ToolCallPart
 }
 
 func (r *openaiChunkResponse) Text() string {
@@ -252,16 +430,16 @@ func (r *openaiChunkResponse) Thought() string {
 }
 
 func (r *openaiChunkResponse) ToolCalls() []provider.ToolCallPart {
+	return r.calls
+}
+
+func (r *openaiChunkResponse) Usage() provider.Usage {
+	return toUsage(r.chunk.Usage)
+}
+
+func (r *openaiChunkResponse) FinishReason() provider.FinishReason {
 	if len(r.chunk.Choices) == 0 {
-		return nil
-	}
-	var calls []provider.ToolCallPart
-	for _, call := range r.chunk.Choices[0].Delta.ToolCalls {
-		calls = append(calls, provider.ToolCallPart{
-			ID:        call.ID,
-			Name:      call.Function.Name,
-			Arguments: call.Function.Arguments,
-		})
+		return provider.FinishReasonUnspecified
 	}
-	return calls
+	return toFinishReason(r.chunk.Choices[0].FinishReason)
 }
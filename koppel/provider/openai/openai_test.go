@@ -1,9 +1,12 @@
 package openai
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/openai/openai-go/v3"
 	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
 )
 
 func TestOpenAIProvider_Interface(t *testing.T) {
@@ -28,7 +31,10 @@ func TestToChatParams(t *testing.T) {
 		},
 	}
 
-	params := p.toChatParams("gpt-4o", messages)
+	params, err := p.toChatParams("gpt-4o", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
 	if params.Model != "gpt-4o" {
 		t.Errorf("expected model gpt-4o, got %s", params.Model)
 	}
@@ -70,3 +76,182 @@ func TestToChatParams(t *testing.T) {
 		t.Error("expected non-empty image URL")
 	}
 }
+
+func TestToChatParams_ToolResult(t *testing.T) {
+	p := &OpenAIProvider{}
+	messages := []provider.Message{{
+		Role: "tool",
+		Parts: []provider.Part{
+			provider.ToolResultPart{
+				ID:      "call_1",
+				Name:    "screenshot",
+				Content: "captured",
+				Parts: []provider.Part{
+					provider.JSONPart(`{"width":800}`),
+					provider.BlobPart{MIMEType: "image/png", Data: []byte("png")},
+					provider.BlobPart{MIMEType: "application/zip", Data: []byte("zip")},
+				},
+			},
+		},
+	}}
+
+	params, err := p.toChatParams("gpt-4o", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
+	if len(params.Messages) != 2 {
+		t.Fatalf("expected a tool and a user message, got %d messages", len(params.Messages))
+	}
+	toolMsg := params.Messages[0].OfTool
+	want := "captured\n{\"width\":800}\n[application/zip attachment of 3 bytes omitted]"
+	if toolMsg == nil || toolMsg.ToolCallID != "call_1" || toolMsg.Content.OfString.Value != want {
+		t.Errorf("unexpected tool message %+v", toolMsg)
+	}
+	images := params.Messages[1].OfUser
+	if images == nil || len(images.Content.OfArrayOfContentParts) != 2 || images.Content.OfArrayOfContentParts[1].OfImageURL == nil {
+		t.Errorf("expected the image in a following user message, got %+v", params.Messages[1])
+	}
+
+	messages = []provider.Message{{
+		Role:  "tool",
+		Parts: []provider.Part{provider.ToolResultPart{ID: "call_2", Name: "fetch", Content: "not found", IsError: true}},
+	}}
+	params, err = p.toChatParams("gpt-4o", messages, provider.Options{})
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
+	if toolMsg := params.Messages[0].OfTool; toolMsg == nil || toolMsg.Content.OfString.Value != "error: not found" {
+		t.Errorf("expected the failure to be marked in the content, got %+v", params.Messages[0])
+	}
+}
+
+func TestToChatParams_Options(t *testing.T) {
+	p := &OpenAIProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTemperature(0.5),
+		provider.WithTopP(0.9),
+		provider.WithMaxOutputTokens(256),
+		provider.WithStopSequences("END"),
+		provider.WithSeed(42),
+		provider.WithSystemInstruction("be brief"),
+		provider.WithToolChoice(provider.ToolChoiceRequired),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toChatParams("gpt-4o", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hello")}},
+	}, opts)
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
+
+	if params.Temperature.Value != 0.5 || params.TopP.Value != 0.9 {
+		t.Errorf("unexpected sampling params: %v, %v", params.Temperature, params.TopP)
+	}
+	if params.MaxCompletionTokens.Value != 256 {
+		t.Errorf("expected max completion tokens 256, got %v", params.MaxCompletionTokens)
+	}
+	if len(params.Stop.OfStringArray) != 1 || params.Stop.OfStringArray[0] != "END" {
+		t.Errorf("unexpected stop sequences: %+v", params.Stop)
+	}
+	if params.Seed.Value != 42 {
+		t.Errorf("expected seed 42, got %v", params.Seed)
+	}
+	if params.ToolChoice.OfAuto.Value != "required" {
+		t.Errorf("expected tool choice required, got %+v", params.ToolChoice)
+	}
+	if len(params.Messages) != 2 || params.Messages[0].OfSystem == nil {
+		t.Fatalf("expected system instruction to be prepended, got %d messages", len(params.Messages))
+	}
+}
+
+func TestToChatParams_ForcedTool(t *testing.T) {
+	p := &OpenAIProvider{}
+	opts, err := provider.NewOptions(
+		provider.WithTools(tool.Definition{Name: "weather"}),
+		provider.WithForcedTool("weather"),
+		provider.WithParallelToolCalls(false),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toChatParams("gpt-4o", nil, opts)
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
+	if named := params.ToolChoice.OfFunctionToolChoice; named == nil || named.Function.Name != "weather" {
+		t.Errorf("expected the weather tool to be forced, got %+v", params.ToolChoice)
+	}
+	if !params.ParallelToolCalls.Valid() || params.ParallelToolCalls.Value {
+		t.Errorf("expected parallel tool calls to be disabled, got %+v", params.ParallelToolCalls)
+	}
+}
+
+func TestToChatParams_ResponseSchema(t *testing.T) {
+	p := &OpenAIProvider{}
+	schema := map[string]interface{}{"type": "object"}
+	opts, err := provider.NewOptions(provider.WithResponseSchema("answer", schema))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+
+	params, err := p.toChatParams("gpt-4o", nil, opts)
+	if err != nil {
+		t.Fatalf("toChatParams failed: %v", err)
+	}
+	format := params.ResponseFormat.OfJSONSchema
+	if format == nil || format.JSONSchema.Name != "answer" || format.JSONSchema.Schema == nil {
+		t.Errorf("expected a json_schema response format, got %+v", params.ResponseFormat)
+	}
+}
+
+func TestToChatParams_UnsupportedOptions(t *testing.T) {
+	p := &OpenAIProvider{}
+	for _, opt := range []provider.Option{
+		provider.WithTopK(40),
+		provider.WithCacheName("cachedContents/abc"),
+	} {
+		opts, err := provider.NewOptions(opt)
+		if err != nil {
+			t.Fatalf("NewOptions failed: %v", err)
+		}
+		if _, err := p.toChatParams("gpt-4o", nil, opts); !errors.Is(err, provider.ErrUnsupportedOption) {
+			t.Errorf("expected ErrUnsupportedOption, got %v", err)
+		}
+	}
+}
+
+func TestOpenAIResponse_Usage(t *testing.T) {
+	resp := &openaiResponse{resp: &openai.ChatCompletion{
+		Usage: openai.CompletionUsage{
+			PromptTokens:            120,
+			CompletionTokens:        40,
+			PromptTokensDetails:     openai.CompletionUsagePromptTokensDetails{CachedTokens: 100},
+			CompletionTokensDetails: openai.CompletionUsageCompletionTokensDetails{ReasoningTokens: 30},
+		},
+	}}
+	want := provider.Usage{InputTokens: 120, OutputTokens: 40, ThinkingTokens: 30, CachedInputTokens: 100}
+	if got := resp.Usage(); got != want {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestToFinishReason(t *testing.T) {
+	tests := map[string]provider.FinishReason{
+		"":               provider.FinishReasonUnspecified,
+		"stop":           provider.FinishReasonStop,
+		"length":         provider.FinishReasonLength,
+		"tool_calls":     provider.FinishReasonToolCalls,
+		"function_call":  provider.FinishReasonToolCalls,
+		"content_filter": provider.FinishReasonContentFilter,
+		"something_new":  provider.FinishReasonOther,
+	}
+	for in, want := range tests {
+		if got := toFinishReason(in); got != want {
+			t.Errorf("toFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package openai
+
+import (
+	"errors"
+	"slices"
+
+	"gosuda.org/koppel/tool"
+)
+
+// strictUnsupported lists the keywords structured outputs reject in strict
+// mode.
+var strictUnsupported = []string{
+	"allOf", "oneOf", "not", "if", "then", "else",
+	"dependentRequired", "dependentSchemas", "patternProperties",
+	"unevaluatedProperties", "unevaluatedItems", "propertyNames",
+	"minProperties", "maxProperties", "contains", "minContains", "maxContains",
+	"uniqueItems", "contentEncoding",
+}
+
+// toParameters normalizes a tool input or response schema. OpenAI requires
+// an object schema with properties at the top level. It reports whether the
+// schema can be used in strict mode, in which case objects are closed with
+// additionalProperties set to false.
+func toParameters(s interface{}) (map[string]interface{}, bool, error) {
+	schema, err := tool.NormalizeSchema(s)
+	if err != nil {
+		return nil, false, err
+	}
+	switch types := tool.SchemaTypes(schema); {
+	case len(types) == 0 && schema["anyOf"] == nil:
+		schema["type"] = "object"
+	case len(types) != 1 || types[0] != "object":
+		return nil, false, errors.New("schema must describe an object")
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]interface{}{}
+	}
+
+	if !strictCompatible(schema) {
+		return schema, false, nil
+	}
+	tool.WalkSchema(schema, func(s map[string]interface{}) {
+		if slices.Contains(tool.SchemaTypes(s), "object") {
+			s["additionalProperties"] = false
+		}
+	})
+	return schema, true, nil
+}
+
+// strictCompatible reports whether every subschema of schema follows the
+// strict mode rules: a type, anyOf, $ref or enum on each schema, all
+// properties required and no open objects.
+func strictCompatible(schema map[string]interface{}) bool {
+	if _, ok := schema["anyOf"]; ok {
+		return false
+	}
+	compatible := true
+	tool.WalkSchema(schema, func(s map[string]interface{}) {
+		for _, key := range strictUnsupported {
+			if _, ok := s[key]; ok {
+				compatible = false
+			}
+		}
+		_, hasType := s["type"]
+		_, hasAnyOf := s["anyOf"]
+		_, hasRef := s["$ref"]
+		_, hasEnum := s["enum"]
+		_, hasConst := s["const"]
+		if !hasType && !hasAnyOf && !hasRef && !hasEnum && !hasConst {
+			compatible = false
+		}
+		if !slices.Contains(tool.SchemaTypes(s), "object") {
+			return
+		}
+		if ap, ok := s["additionalProperties"]; ok && ap != false {
+			compatible = false
+		}
+		props, _ := s["properties"].(map[string]interface{})
+		required, _ := s["required"].([]interface{})
+		for name := range props {
+			if !slices.Contains(required, interface{}(name)) {
+				compatible = false
+			}
+		}
+	})
+	return compatible
+}
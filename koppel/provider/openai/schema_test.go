@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gosuda.org/koppel/provider"
+	"gosuda.org/koppel/tool"
+)
+
+func TestToParameters_Strict(t *testing.T) {
+	schema, err := tool.GenerateSchema(struct {
+		City  string   `json:"city"`
+		Units []string `json:"units"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(schema, "additionalProperties")
+
+	params, strict, err := toParameters(schema)
+	if err != nil {
+		t.Fatalf("toParameters failed: %v", err)
+	}
+	if !strict {
+		t.Fatal("expected a fully required schema to be strict")
+	}
+	if params["additionalProperties"] != false {
+		t.Errorf("expected the object to be closed, got %v", params)
+	}
+	if _, ok := schema["additionalProperties"]; ok {
+		t.Error("expected the input schema to be left untouched")
+	}
+}
+
+func TestToParameters_NotStrict(t *testing.T) {
+	for name, schema := range map[string]string{
+		"optional property": `{"type":"object","properties":{"a":{"type":"string"}}}`,
+		"open object":       `{"type":"object","properties":{"a":{"type":"object","additionalProperties":{"type":"string"}}},"required":["a"]}`,
+		"untyped property":  `{"type":"object","properties":{"a":{}},"required":["a"]}`,
+		"unsupported":       `{"type":"object","properties":{"a":{"type":"array","uniqueItems":true}},"required":["a"]}`,
+	} {
+		params, strict, err := toParameters(json.RawMessage(schema))
+		if err != nil {
+			t.Fatalf("%s: toParameters failed: %v", name, err)
+		}
+		if strict {
+			t.Errorf("%s: expected a non-strict schema", name)
+		}
+		if _, ok := params["additionalProperties"]; ok {
+			t.Errorf("%s: expected the root to stay open", name)
+		}
+	}
+}
+
+func TestToParameters_Defaults(t *testing.T) {
+	params, strict, err := toParameters(nil)
+	if err != nil {
+		t.Fatalf("toParameters failed: %v", err)
+	}
+	if params["type"] != "object" || params["properties"] == nil || !strict {
+		t.Errorf("expected an empty strict object schema, got %v (strict %v)", params, strict)
+	}
+
+	for _, schema := range []interface{}{
+		json.RawMessage(`{"type":"string"}`),
+		json.RawMessage(`{"anyOf":[{"type":"object"}]}`),
+		"not json",
+	} {
+		if _, _, err := toParameters(schema); err == nil {
+			t.Errorf("expected an error for %v", schema)
+		}
+	}
+}
+
+func TestToChatParams_InvalidToolSchema(t *testing.T) {
+	p := &OpenAIProvider{}
+	opts, err := provider.NewOptions(provider.WithTools(tool.Definition{
+		Name:        "broken",
+		InputSchema: []string{"not", "a", "schema"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.toChatParams("gpt-4o", nil, opts); err == nil {
+		t.Error("expected an error instead of a panic")
+	}
+}
@@ -0,0 +1,132 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openai/openai-go/v3/option"
+	"gosuda.org/koppel/provider"
+)
+
+// newSSEProvider returns a provider whose chat completions endpoint streams
+// chunks and records the decoded request body.
+func newSSEProvider(t *testing.T, request *map[string]interface{}, chunks ...string) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if request != nil {
+			json.NewDecoder(r.Body).Decode(request)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"), option.WithMaxRetries(0))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+// drain reads chunks until the stream ends and returns them.
+func drain(t *testing.T, stream provider.StreamResponse) []provider.Response {
+	t.Helper()
+	var chunks []provider.Response
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		chunks = append(chunks, resp)
+	}
+	if _, err := stream.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF after the last chunk, got %v", err)
+	}
+	return chunks
+}
+
+func TestOpenAIStream_Usage(t *testing.T) {
+	var request map[string]interface{}
+	p := newSSEProvider(t, &request,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14}}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), "gpt-4o", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("hi")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	var usage provider.Usage
+	for _, chunk := range drain(t, stream) {
+		text += chunk.Text()
+		if u := chunk.Usage(); !u.IsZero() {
+			usage = u
+		}
+	}
+	if text != "Hello" {
+		t.Errorf("unexpected text: %q", text)
+	}
+	if want := (provider.Usage{InputTokens: 12, OutputTokens: 2}); usage != want {
+		t.Errorf("final usage = %+v, want %+v", usage, want)
+	}
+	streamOptions, _ := request["stream_options"].(map[string]interface{})
+	if streamOptions["include_usage"] != true {
+		t.Errorf("expected include_usage in request, got %v", request["stream_options"])
+	}
+}
+
+func TestOpenAIStream_ToolCalls(t *testing.T) {
+	p := newSSEProvider(t, nil,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"weather","arguments":""}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"time","arguments":"{}"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Seoul\"}"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+	)
+
+	stream, err := p.GenerateContentStream(context.Background(), "gpt-4o", []provider.Message{
+		{Role: "user", Parts: []provider.Part{provider.TextPart("weather?")}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	chunks := drain(t, stream)
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk.ToolCalls()) > 0 {
+			t.Errorf("expected no partial tool calls before the finish reason, got %+v", chunk.ToolCalls())
+		}
+	}
+	last := chunks[len(chunks)-1]
+	if last.FinishReason() != provider.FinishReasonToolCalls {
+		t.Errorf("expected finish reason tool_calls, got %q", last.FinishReason())
+	}
+	want := []provider.ToolCallPart{
+		{ID: "call_a", Name: "weather", Arguments: `{"city":"Seoul"}`},
+		{ID: "call_b", Name: "time", Arguments: "{}"},
+	}
+	calls := last.ToolCalls()
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d tool calls, got %+v", len(want), calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+}
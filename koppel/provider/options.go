@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	"gosuda.org/koppel/tool"
+)
+
+// WithTools makes tools available to the model.
+func WithTools(tools ...tool.Definition) Option {
+	return func(o *Options) error {
+		o.Tools = append(o.Tools, tools...)
+		return nil
+	}
+}
+
+// WithCacheName generates content on top of a previously created context cache.
+func WithCacheName(name string) Option {
+	return func(o *Options) error {
+		if name == "" {
+			return errors.New("cache name must not be empty")
+		}
+		o.CacheName = name
+		return nil
+	}
+}
+
+// WithCacheSystem marks the system prompt as a prompt cache breakpoint on
+// providers with explicit prompt caching.
+func WithCacheSystem() Option {
+	return func(o *Options) error {
+		o.CacheSystem = true
+		return nil
+	}
+}
+
+// WithCacheTools marks the tool definitions as a prompt cache breakpoint on
+// providers with explicit prompt caching.
+func WithCacheTools() Option {
+	return func(o *Options) error {
+		o.CacheTools = true
+		return nil
+	}
+}
+
+// WithTemperature sets the sampling temperature.
+func WithTemperature(temperature float64) Option {
+	return func(o *Options) error {
+		if temperature < 0 {
+			return fmt.Errorf("temperature must not be negative, got %v", temperature)
+		}
+		o.Temperature = &temperature
+		return nil
+	}
+}
+
+// WithTopP sets the nucleus sampling probability mass.
+func WithTopP(topP float64) Option {
+	return func(o *Options) error {
+		if topP < 0 || topP > 1 {
+			return fmt.Errorf("top-p must be between 0 and 1, got %v", topP)
+		}
+		o.TopP = &topP
+		return nil
+	}
+}
+
+// WithTopK limits sampling to the k most likely tokens.
+func WithTopK(topK int) Option {
+	return func(o *Options) error {
+		if topK <= 0 {
+			return fmt.Errorf("top-k must be positive, got %d", topK)
+		}
+		o.TopK = &topK
+		return nil
+	}
+}
+
+// WithMaxOutputTokens caps the number of generated tokens.
+func WithMaxOutputTokens(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("max output tokens must be positive, got %d", n)
+		}
+		o.MaxOutputTokens = n
+		return nil
+	}
+}
+
+// WithStopSequences stops generation at any of the given sequences.
+func WithStopSequences(sequences ...string) Option {
+	return func(o *Options) error {
+		o.StopSequences = append(o.StopSequences, sequences...)
+		return nil
+	}
+}
+
+// WithSeed requests deterministic sampling where the provider supports it.
+func WithSeed(seed int64) Option {
+	return func(o *Options) error {
+		o.Seed = &seed
+		return nil
+	}
+}
+
+// WithSystemInstruction sets a system prompt that precedes any system messages.
+func WithSystemInstruction(instruction string) Option {
+	return func(o *Options) error {
+		o.SystemInstruction = instruction
+		return nil
+	}
+}
+
+// WithToolChoice controls whether and how the model calls tools. Use
+// WithForcedTool to force a specific tool.
+func WithToolChoice(choice ToolChoice) Option {
+	return func(o *Options) error {
+		switch choice {
+		case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		case ToolChoiceTool:
+			return errors.New("use WithForcedTool to force a specific tool")
+		default:
+			return fmt.Errorf("unknown tool choice %q", choice)
+		}
+		o.ToolChoice = choice
+		o.ToolName = ""
+		return nil
+	}
+}
+
+// WithForcedTool forces the model to call the tool named name, which must
+// be one of the tools offered.
+func WithForcedTool(name string) Option {
+	return func(o *Options) error {
+		if name == "" {
+			return errors.New("forced tool name must not be empty")
+		}
+		o.ToolChoice = ToolChoiceTool
+		o.ToolName = name
+		return nil
+	}
+}
+
+// WithParallelToolCalls sets whether the model may request several tool
+// calls in one reply. Providers allow it by default.
+func WithParallelToolCalls(enabled bool) Option {
+	return func(o *Options) error {
+		o.ParallelToolCalls = &enabled
+		return nil
+	}
+}
+
+// WithResponseSchema constrains the reply to JSON matching schema. name may
+// contain letters, digits, underscores and dashes, up to 64 characters.
+func WithResponseSchema(name string, schema interface{}) Option {
+	return func(o *Options) error {
+		if !validSchemaName(name) {
+			return fmt.Errorf("invalid response schema name %q", name)
+		}
+		if schema == nil {
+			return errors.New("response schema must not be nil")
+		}
+		o.ResponseSchema = &ResponseSchema{Name: name, Schema: schema}
+		return nil
+	}
+}
+
+func validSchemaName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
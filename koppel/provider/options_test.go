@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+
+	"gosuda.org/koppel/tool"
+)
+
+func TestNewOptions(t *testing.T) {
+	opts, err := NewOptions(
+		WithTools(tool.Definition{Name: "a"}),
+		WithTools(tool.Definition{Name: "b"}),
+		WithCacheName("cachedContents/abc"),
+		WithTemperature(0.3),
+		WithStopSequences("x", "y"),
+		WithToolChoice(ToolChoiceNone),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+	if len(opts.Tools) != 2 {
+		t.Errorf("expected tools to accumulate, got %d", len(opts.Tools))
+	}
+	if opts.CacheName != "cachedContents/abc" || *opts.Temperature != 0.3 {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if len(opts.StopSequences) != 2 || opts.ToolChoice != ToolChoiceNone {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+}
+
+func TestNewOptions_Invalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"negative temperature": WithTemperature(-1),
+		"top-p above one":      WithTopP(1.5),
+		"zero top-k":           WithTopK(0),
+		"zero max tokens":      WithMaxOutputTokens(0),
+		"empty cache name":     WithCacheName(""),
+		"unknown tool choice":  WithToolChoice("sometimes"),
+		"unnamed tool choice":  WithToolChoice(ToolChoiceTool),
+		"empty forced tool":    WithForcedTool(""),
+		"unknown forced tool":  WithForcedTool("missing"),
+		"bad schema name":      WithResponseSchema("my schema", map[string]interface{}{}),
+		"nil schema":           WithResponseSchema("answer", nil),
+	} {
+		if _, err := NewOptions(opt); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNewOptions_ForcedTool(t *testing.T) {
+	opts, err := NewOptions(
+		WithForcedTool("b"),
+		WithTools(tool.Definition{Name: "a"}, tool.Definition{Name: "b"}),
+		WithParallelToolCalls(false),
+	)
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+	if opts.ToolChoice != ToolChoiceTool || opts.ToolName != "b" {
+		t.Errorf("expected tool b to be forced, got %q %q", opts.ToolChoice, opts.ToolName)
+	}
+	if opts.ParallelToolCalls == nil || *opts.ParallelToolCalls {
+		t.Errorf("expected parallel tool calls to be disabled, got %v", opts.ParallelToolCalls)
+	}
+
+	opts, err = NewOptions(WithForcedTool("b"), WithToolChoice(ToolChoiceAuto))
+	if err != nil {
+		t.Fatalf("NewOptions failed: %v", err)
+	}
+	if opts.ToolChoice != ToolChoiceAuto || opts.ToolName != "" {
+		t.Errorf("expected a later tool choice to replace the forced tool, got %q %q", opts.ToolChoice, opts.ToolName)
+	}
+}
+
+func TestUnsupportedOptionError(t *testing.T) {
+	err := UnsupportedOptionError("openai", "top-k")
+	if !errors.Is(err, ErrUnsupportedOption) {
+		t.Errorf("expected error to wrap ErrUnsupportedOption, got %v", err)
+	}
+}
@@ -3,16 +3,72 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"slices"
+	"strings"
 	"time"
 
 	"gosuda.org/koppel/tool"
 )
 
+// ErrUnsupportedOption is wrapped by errors returned when a provider cannot
+// honor one of the requested options.
+var ErrUnsupportedOption = errors.New("unsupported option")
+
+// UnsupportedOptionError reports that providerName cannot honor option.
+func UnsupportedOptionError(providerName, option string) error {
+	return &Error{
+		Provider: providerName,
+		Kind:     ErrorKindInvalidRequest,
+		Message:  fmt.Sprintf("%v: %s", ErrUnsupportedOption, option),
+		Err:      ErrUnsupportedOption,
+	}
+}
+
+type ToolChoice string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool.
+	ToolChoiceAuto ToolChoice = "auto"
+	// ToolChoiceNone prevents the model from calling any tool.
+	ToolChoiceNone ToolChoice = "none"
+	// ToolChoiceRequired forces the model to call at least one tool.
+	ToolChoiceRequired ToolChoice = "required"
+	// ToolChoiceTool forces the model to call the tool named by
+	// Options.ToolName. It is set with WithForcedTool.
+	ToolChoiceTool ToolChoice = "tool"
+)
+
+// ResponseSchema constrains the reply to a JSON document matching Schema.
+type ResponseSchema struct {
+	// Name identifies the schema to the model; it may contain letters,
+	// digits, underscores and dashes.
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+}
+
 type Options struct {
-	CacheName string            `json:"cache_name,omitempty"`
-	Tools     []tool.Definition `json:"tools,omitempty"`
+	CacheName         string            `json:"cache_name,omitempty"`
+	CacheSystem       bool              `json:"cache_system,omitempty"`
+	CacheTools        bool              `json:"cache_tools,omitempty"`
+	Tools             []tool.Definition `json:"tools,omitempty"`
+	Temperature       *float64          `json:"temperature,omitempty"`
+	TopP              *float64          `json:"top_p,omitempty"`
+	TopK              *int              `json:"top_k,omitempty"`
+	MaxOutputTokens   int               `json:"max_output_tokens,omitempty"`
+	StopSequences     []string          `json:"stop_sequences,omitempty"`
+	Seed              *int64            `json:"seed,omitempty"`
+	SystemInstruction string            `json:"system_instruction,omitempty"`
+	ToolChoice        ToolChoice        `json:"tool_choice,omitempty"`
+	ToolName          string            `json:"tool_name,omitempty"`
+	// ParallelToolCalls, when false, limits the model to at most one tool
+	// call per reply.
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	ResponseSchema    *ResponseSchema `json:"response_schema,omitempty"`
 }
 
 type Option func(*Options) error
@@ -24,6 +80,11 @@ func NewOptions(options ...Option) (Options, error) {
 			return opts, err
 		}
 	}
+	if opts.ToolChoice == ToolChoiceTool && !slices.ContainsFunc(opts.Tools, func(t tool.Definition) bool {
+		return t.Name == opts.ToolName
+	}) {
+		return opts, fmt.Errorf("forced tool %q is not among the tools", opts.ToolName)
+	}
 	return opts, nil
 }
 
@@ -42,52 +103,191 @@ type BlobPart struct {
 
 func (BlobPart) IsPart() {}
 
-type ThoughtPart string
+// ThoughtPart is the reasoning a model produced before its reply.
+// Signature is an opaque token that some providers require to accept the
+// thought back in later turns; for redacted thoughts, whose text the
+// provider withholds, it holds the encrypted thought instead. Provider names
+// the provider that produced the thought, since signatures are only valid
+// there.
+type ThoughtPart struct {
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Redacted  bool   `json:"redacted,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+}
 
 func (ThoughtPart) IsPart() {}
 
+// AppendThought appends a streamed thought fragment to parts. Fragments
+// extend the last thought until it is signed or redacted, so that a stream
+// of fragments accumulates to the thoughts of the complete reply.
+func AppendThought(parts []ThoughtPart, p ThoughtPart) []ThoughtPart {
+	if n := len(parts); n > 0 && !p.Redacted {
+		last := &parts[n-1]
+		if !last.Redacted && last.Signature == "" && last.Provider == p.Provider {
+			last.Text += p.Text
+			last.Signature = p.Signature
+			return parts
+		}
+	}
+	return append(parts, p)
+}
+
 type ToolCallPart struct {
 	ID        string `json:"id"`
 	Name      string `json:"name"`
 	Arguments string `json:"arguments"`
+	// ThoughtSignature is an opaque token some providers attach to calls
+	// made while thinking, to be sent back with the call.
+	ThoughtSignature string `json:"thought_signature,omitempty"`
 }
 
 func (ToolCallPart) IsPart() {}
 
+// JSONPart is a JSON document, such as the structured output of a tool.
+type JSONPart json.RawMessage
+
+func (JSONPart) IsPart() {}
+
 type ToolResultPart struct {
 	ID      string `json:"id"`
 	Name    string `json:"name"`
 	Content string `json:"content"`
+	// Parts holds further content of the result after Content: TextPart,
+	// BlobPart or JSONPart values. Providers that cannot return blobs from
+	// tools pass them on another way or describe them in text.
+	Parts []Part `json:"parts,omitempty"`
+	// IsError marks the result as a failed call.
+	IsError bool `json:"is_error,omitempty"`
 }
 
 func (ToolResultPart) IsPart() {}
 
+// Text returns Content followed by the text and JSON parts of the result,
+// separated by newlines. Blobs are left out.
+func (p ToolResultPart) Text() string {
+	texts := make([]string, 0, len(p.Parts)+1)
+	if p.Content != "" {
+		texts = append(texts, p.Content)
+	}
+	for _, part := range p.Parts {
+		switch v := part.(type) {
+		case TextPart:
+			texts = append(texts, string(v))
+		case JSONPart:
+			texts = append(texts, string(v))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Blobs returns the blob parts of the result.
+func (p ToolResultPart) Blobs() []BlobPart {
+	var blobs []BlobPart
+	for _, part := range p.Parts {
+		if b, ok := part.(BlobPart); ok {
+			blobs = append(blobs, b)
+		}
+	}
+	return blobs
+}
+
+// FinishReason is the normalized reason a model stopped generating.
+type FinishReason string
+
+const (
+	// FinishReasonUnspecified is reported by stream chunks before the last
+	// and by providers that did not say why generation stopped.
+	FinishReasonUnspecified FinishReason = ""
+	// FinishReasonStop is a natural end of the reply or a stop sequence.
+	FinishReasonStop FinishReason = "stop"
+	// FinishReasonLength means the reply was truncated by the token limit.
+	FinishReasonLength FinishReason = "length"
+	// FinishReasonToolCalls means the model stopped to call tools.
+	FinishReasonToolCalls FinishReason = "tool_calls"
+	// FinishReasonContentFilter means the reply was blocked or refused.
+	FinishReasonContentFilter FinishReason = "content_filter"
+	// FinishReasonOther covers any other provider-specific reason.
+	FinishReasonOther FinishReason = "other"
+)
+
 type Response interface {
 	Text() string
 	Thought() string
 	ToolCalls() []ToolCallPart
+	// Usage reports the tokens consumed by the response. Stream chunks that
+	// carry no usage report zero; the last non-zero usage of a stream is its
+	// total.
+	Usage() Usage
+	// FinishReason reports why generation stopped. For streams it is set
+	// on the final chunk only.
+	FinishReason() FinishReason
+}
+
+// ThoughtResponse is implemented by responses that can report their
+// thoughts as parts, with the signatures needed to send them back. Stream
+// chunks report fragments to be joined with AppendThought.
+type ThoughtResponse interface {
+	Response
+	ThoughtParts() []ThoughtPart
 }
 
+// StreamResponse yields the chunks of a streamed reply. Next returns io.EOF
+// once the stream is exhausted.
 type StreamResponse interface {
 	Next() (Response, error)
+	// All returns an iterator over the remaining chunks. Iteration stops
+	// at the end of the stream or after yielding the first error; it does
+	// not close the stream.
+	All() iter.Seq2[Response, error]
 	io.Closer
 }
 
+// Iterate adapts the Next method of s to an iterator. StreamResponse
+// implementations use it to provide All.
+func Iterate(s StreamResponse) iter.Seq2[Response, error] {
+	return func(yield func(Response, error) bool) {
+		for {
+			resp, err := s.Next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+	}
+}
+
 type Message struct {
 	Role  string `json:"role"`
 	Parts []Part `json:"parts"`
+	// CacheBreakpoint marks the end of a prompt prefix that providers with
+	// explicit prompt caching should cache. Providers that cache prefixes
+	// automatically ignore it.
+	CacheBreakpoint bool `json:"cache_breakpoint,omitempty"`
 }
 
 type partJSON struct {
-	Type      string      `json:"type"`
-	Text      string      `json:"text,omitempty"`
-	MIMEType  string      `json:"mime_type,omitempty"`
-	Data      []byte      `json:"data,omitempty"`
-	Thought   string      `json:"thought,omitempty"`
-	ID        string      `json:"id,omitempty"`
-	Name      string      `json:"name,omitempty"`
-	Arguments string      `json:"arguments,omitempty"`
-	Content   interface{} `json:"content,omitempty"`
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	MIMEType  string          `json:"mime_type,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+	Thought   string          `json:"thought,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Redacted  bool            `json:"redacted,omitempty"`
+	Provider  string          `json:"provider,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Content   interface{}     `json:"content,omitempty"`
+	Parts     []partJSON      `json:"parts,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	JSON      json.RawMessage `json:"json,omitempty"`
 }
 
 func (m *Message) UnmarshalJSON(data []byte) error {
@@ -102,17 +302,28 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	m.Parts = make([]Part, len(aux.Parts))
-	for i, p := range aux.Parts {
+	parts, err := decodeParts(aux.Parts)
+	if err != nil {
+		return err
+	}
+	m.Parts = parts
+	return nil
+}
+
+func decodeParts(in []partJSON) ([]Part, error) {
+	parts := make([]Part, len(in))
+	for i, p := range in {
 		switch p.Type {
 		case "text":
-			m.Parts[i] = TextPart(p.Text)
+			parts[i] = TextPart(p.Text)
 		case "blob":
-			m.Parts[i] = BlobPart{MIMEType: p.MIMEType, Data: p.Data}
+			parts[i] = BlobPart{MIMEType: p.MIMEType, Data: p.Data}
+		case "json":
+			parts[i] = JSONPart(p.JSON)
 		case "thought":
-			m.Parts[i] = ThoughtPart(p.Thought)
+			parts[i] = ThoughtPart{Text: p.Thought, Signature: p.Signature, Redacted: p.Redacted, Provider: p.Provider}
 		case "tool_call":
-			m.Parts[i] = ToolCallPart{ID: p.ID, Name: p.Name, Arguments: p.Arguments}
+			parts[i] = ToolCallPart{ID: p.ID, Name: p.Name, Arguments: p.Arguments, ThoughtSignature: p.Signature}
 		case "tool_result":
 			// Content in partJSON is interface{}, but ToolResultPart expects string.
 			// Re-marshal and unmarshal or just cast if it's string.
@@ -123,39 +334,55 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 				b, _ := json.Marshal(p.Content)
 				content = string(b)
 			}
-			m.Parts[i] = ToolResultPart{ID: p.ID, Name: p.Name, Content: content}
+			result := ToolResultPart{ID: p.ID, Name: p.Name, Content: content, IsError: p.IsError}
+			if len(p.Parts) > 0 {
+				nested, err := decodeParts(p.Parts)
+				if err != nil {
+					return nil, err
+				}
+				result.Parts = nested
+			}
+			parts[i] = result
 		default:
-			return fmt.Errorf("unknown part type: %s", p.Type)
+			return nil, fmt.Errorf("unknown part type: %s", p.Type)
 		}
 	}
-	return nil
+	return parts, nil
 }
 
 func (m Message) MarshalJSON() ([]byte, error) {
 	type Alias Message
-	parts := make([]partJSON, len(m.Parts))
-	for i, p := range m.Parts {
+	return json.Marshal(&struct {
+		Parts []partJSON `json:"parts"`
+		*Alias
+	}{
+		Parts: encodeParts(m.Parts),
+		Alias: (*Alias)(&m),
+	})
+}
+
+func encodeParts(in []Part) []partJSON {
+	parts := make([]partJSON, len(in))
+	for i, p := range in {
 		switch v := p.(type) {
 		case TextPart:
 			parts[i] = partJSON{Type: "text", Text: string(v)}
 		case BlobPart:
 			parts[i] = partJSON{Type: "blob", MIMEType: v.MIMEType, Data: v.Data}
+		case JSONPart:
+			parts[i] = partJSON{Type: "json", JSON: json.RawMessage(v)}
 		case ThoughtPart:
-			parts[i] = partJSON{Type: "thought", Thought: string(v)}
+			parts[i] = partJSON{Type: "thought", Thought: v.Text, Signature: v.Signature, Redacted: v.Redacted, Provider: v.Provider}
 		case ToolCallPart:
-			parts[i] = partJSON{Type: "tool_call", ID: v.ID, Name: v.Name, Arguments: v.Arguments}
+			parts[i] = partJSON{Type: "tool_call", ID: v.ID, Name: v.Name, Arguments: v.Arguments, Signature: v.ThoughtSignature}
 		case ToolResultPart:
-			parts[i] = partJSON{Type: "tool_result", ID: v.ID, Name: v.Name, Content: v.Content}
+			parts[i] = partJSON{Type: "tool_result", ID: v.ID, Name: v.Name, Content: v.Content, IsError: v.IsError}
+			if len(v.Parts) > 0 {
+				parts[i].Parts = encodeParts(v.Parts)
+			}
 		}
 	}
-
-	return json.Marshal(&struct {
-		Parts []partJSON `json:"parts"`
-		*Alias
-	}{
-		Parts: parts,
-		Alias: (*Alias)(&m),
-	})
+	return parts
 }
 
 type Provider interface {
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"reflect"
+	"testing"
+)
+
+type textResponse string
+
+func (r textResponse) Text() string               { return string(r) }
+func (r textResponse) Thought() string            { return "" }
+func (r textResponse) ToolCalls() []ToolCallPart  { return nil }
+func (r textResponse) Usage() Usage               { return Usage{} }
+func (r textResponse) FinishReason() FinishReason { return FinishReasonUnspecified }
+
+type sliceStream struct {
+	chunks []string
+	err    error
+	closed bool
+}
+
+func (s *sliceStream) Next() (Response, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return textResponse(chunk), nil
+}
+
+func (s *sliceStream) All() iter.Seq2[Response, error] { return Iterate(s) }
+func (s *sliceStream) Close() error                    { s.closed = true; return nil }
+
+func TestIterate(t *testing.T) {
+	var text string
+	for chunk, err := range (&sliceStream{chunks: []string{"a", "b", "c"}}).All() {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		text += chunk.Text()
+	}
+	if text != "abc" {
+		t.Errorf("expected abc, got %q", text)
+	}
+}
+
+func TestIterate_Error(t *testing.T) {
+	boom := errors.New("boom")
+	var errs []error
+	for _, err := range (&sliceStream{chunks: []string{"a"}, err: boom}).All() {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], boom) {
+		t.Errorf("expected a single boom error, got %v", errs)
+	}
+}
+
+func TestIterate_Break(t *testing.T) {
+	s := &sliceStream{chunks: []string{"a", "b"}}
+	for range s.All() {
+		break
+	}
+	if len(s.chunks) != 1 {
+		t.Errorf("expected iteration to stop after the first chunk, %d left", len(s.chunks))
+	}
+	if s.closed {
+		t.Error("iteration must not close the stream")
+	}
+}
+
+func TestMessage_ToolResultJSON(t *testing.T) {
+	msg := Message{
+		Role: "tool",
+		Parts: []Part{
+			ToolResultPart{
+				ID:      "call_1",
+				Name:    "screenshot",
+				Content: "captured",
+				IsError: true,
+				Parts: []Part{
+					TextPart("page 1"),
+					BlobPart{MIMEType: "image/png", Data: []byte("png")},
+					JSONPart(`{"width":800}`),
+				},
+			},
+			ToolResultPart{ID: "call_2", Name: "plain", Content: "ok"},
+		},
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, msg) {
+		t.Errorf("round trip = %+v, want %+v", decoded, msg)
+	}
+}
+
+func TestToolResultPart_Text(t *testing.T) {
+	r := ToolResultPart{
+		Content: "summary",
+		Parts: []Part{
+			BlobPart{MIMEType: "image/png", Data: []byte("png")},
+			TextPart("details"),
+			JSONPart(`{"n":1}`),
+		},
+	}
+	if got := r.Text(); got != "summary\ndetails\n{\"n\":1}" {
+		t.Errorf("Text() = %q", got)
+	}
+	if blobs := r.Blobs(); len(blobs) != 1 || blobs[0].MIMEType != "image/png" {
+		t.Errorf("unexpected blobs %+v", blobs)
+	}
+}
+
+func TestMessage_ThoughtJSON(t *testing.T) {
+	msg := Message{
+		Role: "model",
+		Parts: []Part{
+			ThoughtPart{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+			ThoughtPart{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+			ToolCallPart{ID: "call_1", Name: "weather", Arguments: "{}", ThoughtSignature: "c2ln"},
+		},
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, msg) {
+		t.Errorf("round trip = %+v, want %+v", decoded, msg)
+	}
+}
+
+func TestAppendThought(t *testing.T) {
+	var parts []ThoughtPart
+	for _, p := range []ThoughtPart{
+		{Text: "Let me ", Provider: "anthropic"},
+		{Text: "see.", Provider: "anthropic"},
+		{Signature: "sig-1", Provider: "anthropic"},
+		{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+		{Text: "More.", Provider: "anthropic"},
+	} {
+		parts = AppendThought(parts, p)
+	}
+	want := []ThoughtPart{
+		{Text: "Let me see.", Signature: "sig-1", Provider: "anthropic"},
+		{Signature: "encrypted", Redacted: true, Provider: "anthropic"},
+		{Text: "More.", Provider: "anthropic"},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("AppendThought = %+v, want %+v", parts, want)
+	}
+}
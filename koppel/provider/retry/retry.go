@@ -0,0 +1,224 @@
+// Package retry wraps a provider.Provider so that transient failures such as
+// rate limits and overloaded servers are retried with exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"time"
+
+	"gosuda.org/koppel/provider"
+)
+
+const (
+	DefaultMaxAttempts    = 4
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+type Options struct {
+	// MaxAttempts is the total number of calls made, including the first.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RetryIf decides whether an error is worth retrying. It defaults to
+	// provider.IsRetryable.
+	RetryIf func(error) bool
+}
+
+type Option func(*Options) error
+
+// WithMaxAttempts sets the total number of calls made, including the first.
+func WithMaxAttempts(n int) Option {
+	return func(o *Options) error {
+		if n < 1 {
+			return errors.New("retry: max attempts must be at least 1")
+		}
+		o.MaxAttempts = n
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap the delay
+// doubles up to.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(o *Options) error {
+		if initial <= 0 || max < initial {
+			return errors.New("retry: backoff must satisfy 0 < initial <= max")
+		}
+		o.InitialBackoff = initial
+		o.MaxBackoff = max
+		return nil
+	}
+}
+
+// WithRetryIf replaces the check that decides whether an error is retried.
+func WithRetryIf(fn func(error) bool) Option {
+	return func(o *Options) error {
+		if fn == nil {
+			return errors.New("retry: retry func must not be nil")
+		}
+		o.RetryIf = fn
+		return nil
+	}
+}
+
+type RetryProvider struct {
+	provider provider.Provider
+	opts     Options
+}
+
+var _ provider.Provider = (*RetryProvider)(nil)
+
+func NewProvider(p provider.Provider, options ...Option) (*RetryProvider, error) {
+	opts := Options{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		RetryIf:        provider.IsRetryable,
+	}
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+	return &RetryProvider{provider: p, opts: opts}, nil
+}
+
+func (p *RetryProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := p.provider.GenerateContent(ctx, model, messages, options...)
+		if err == nil || !p.wait(ctx, attempt, err) {
+			return resp, err
+		}
+	}
+}
+
+// GenerateContentStream opens a stream, retrying failures to open it. Errors
+// returned by the first Next call are retried by reopening the stream; once a
+// chunk has been delivered, errors are returned as they are.
+func (p *RetryProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	s := &retryStream{
+		provider: p,
+		ctx:      ctx,
+		model:    model,
+		messages: messages,
+		options:  options,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// wait sleeps before the next attempt and reports whether it should be made.
+// It gives up without sleeping if err is not retryable, the attempts are
+// exhausted or the context would expire before the delay elapses.
+func (p *RetryProvider) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt+1 >= p.opts.MaxAttempts || !p.opts.RetryIf(err) {
+		return false
+	}
+	delay := p.backoff(attempt, err)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt: the
+// doubled initial backoff with equal jitter, or the provider's retry-after
+// hint if that is longer.
+func (p *RetryProvider) backoff(attempt int, err error) time.Duration {
+	delay := p.opts.InitialBackoff
+	for i := 0; i < attempt && delay < p.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.opts.MaxBackoff)
+	delay = delay/2 + rand.N(delay/2+1)
+
+	var perr *provider.Error
+	if errors.As(err, &perr) && perr.RetryAfter > delay {
+		delay = perr.RetryAfter
+	}
+	return delay
+}
+
+type retryStream struct {
+	provider *RetryProvider
+	ctx      context.Context
+	model    string
+	messages []provider.Message
+	options  []provider.Option
+
+	stream    provider.StreamResponse
+	attempt   int
+	delivered bool
+}
+
+func (s *retryStream) open() error {
+	for {
+		stream, err := s.provider.provider.GenerateContentStream(s.ctx, s.model, s.messages, s.options...)
+		if err == nil {
+			s.stream = stream
+			return nil
+		}
+		if !s.provider.wait(s.ctx, s.attempt, err) {
+			return err
+		}
+		s.attempt++
+	}
+}
+
+func (s *retryStream) Next() (provider.Response, error) {
+	for {
+		resp, err := s.stream.Next()
+		if err == nil {
+			s.delivered = true
+			return resp, nil
+		}
+		if s.delivered || errors.Is(err, io.EOF) || !s.provider.wait(s.ctx, s.attempt, err) {
+			return nil, err
+		}
+		s.stream.Close()
+		s.attempt++
+		if err := s.open(); err != nil {
+			s.stream = failedStream{err}
+			return nil, err
+		}
+	}
+}
+
+func (s *retryStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s *retryStream) Close() error {
+	return s.stream.Close()
+}
+
+// failedStream replaces a stream that could not be reopened.
+type failedStream struct {
+	err error
+}
+
+func (s failedStream) Next() (provider.Response, error) {
+	return nil, s.err
+}
+
+func (s failedStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s failedStream) Close() error {
+	return nil
+}
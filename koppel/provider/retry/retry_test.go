@@ -0,0 +1,235 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"testing"
+	"time"
+
+	"gosuda.org/koppel/provider"
+)
+
+var (
+	errRateLimited = &provider.Error{Provider: "fake", Kind: provider.ErrorKindRateLimited, StatusCode: 429}
+	errAuth        = &provider.Error{Provider: "fake", Kind: provider.ErrorKindAuth, StatusCode: 401}
+)
+
+type textResponse string
+
+func (r textResponse) Text() string                        { return string(r) }
+func (r textResponse) Thought() string                     { return "" }
+func (r textResponse) ToolCalls() []provider.ToolCallPart  { return nil }
+func (r textResponse) Usage() provider.Usage               { return provider.Usage{} }
+func (r textResponse) FinishReason() provider.FinishReason { return provider.FinishReasonStop }
+
+// flakyProvider fails its first calls with the given errors and then
+// succeeds. Streams it opens fail on their first Next with streamErrs.
+type flakyProvider struct {
+	errs       []error
+	streamErrs []error
+	calls      int
+	streams    int
+}
+
+func (p *flakyProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	return textResponse("ok"), nil
+}
+
+func (p *flakyProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	p.streams++
+	s := &fakeStream{chunks: []string{"a", "b"}}
+	if len(p.streamErrs) > 0 {
+		s.err = p.streamErrs[0]
+		p.streamErrs = p.streamErrs[1:]
+	}
+	return s, nil
+}
+
+// fakeStream fails with err before yielding any chunk, or after the chunks if
+// failLate is set. Without err it ends with io.EOF.
+type fakeStream struct {
+	chunks    []string
+	err       error
+	failLate  bool
+	delivered int
+	closed    bool
+}
+
+func (s *fakeStream) Next() (provider.Response, error) {
+	if s.err != nil && (!s.failLate || s.delivered == len(s.chunks)) {
+		return nil, s.err
+	}
+	if s.delivered == len(s.chunks) {
+		return nil, io.EOF
+	}
+	s.delivered++
+	return textResponse(s.chunks[s.delivered-1]), nil
+}
+
+func (s *fakeStream) All() iter.Seq2[provider.Response, error] { return provider.Iterate(s) }
+func (s *fakeStream) Close() error                             { s.closed = true; return nil }
+
+func newTestProvider(t *testing.T, p provider.Provider, options ...Option) *RetryProvider {
+	t.Helper()
+	options = append([]Option{WithBackoff(time.Millisecond, 2*time.Millisecond)}, options...)
+	rp, err := NewProvider(p, options...)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return rp
+}
+
+func TestRetryProvider_GenerateContent(t *testing.T) {
+	fake := &flakyProvider{errs: []error{errRateLimited, errRateLimited}}
+	p := newTestProvider(t, fake)
+
+	resp, err := p.GenerateContent(context.Background(), "model", nil)
+	if err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+	if resp.Text() != "ok" || fake.calls != 3 {
+		t.Errorf("expected success on the third call, got %q after %d calls", resp.Text(), fake.calls)
+	}
+}
+
+func TestRetryProvider_MaxAttempts(t *testing.T) {
+	fake := &flakyProvider{errs: []error{errRateLimited, errRateLimited, errRateLimited}}
+	p := newTestProvider(t, fake, WithMaxAttempts(2))
+
+	_, err := p.GenerateContent(context.Background(), "model", nil)
+	if !errors.Is(err, errRateLimited) {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if fake.calls != 2 {
+		t.Errorf("expected 2 calls, got %d", fake.calls)
+	}
+}
+
+func TestRetryProvider_NotRetryable(t *testing.T) {
+	fake := &flakyProvider{errs: []error{errAuth}}
+	p := newTestProvider(t, fake)
+
+	if _, err := p.GenerateContent(context.Background(), "model", nil); !errors.Is(err, errAuth) {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected no retry, got %d calls", fake.calls)
+	}
+}
+
+func TestRetryProvider_RetryAfterBeyondDeadline(t *testing.T) {
+	slow := &provider.Error{Provider: "fake", Kind: provider.ErrorKindRateLimited, RetryAfter: time.Hour}
+	fake := &flakyProvider{errs: []error{slow}}
+	p := newTestProvider(t, fake)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.GenerateContent(ctx, "model", nil); !errors.Is(err, slow) {
+		t.Fatalf("expected the rate limit error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected to give up without waiting, took %v", elapsed)
+	}
+}
+
+func TestRetryProvider_Backoff(t *testing.T) {
+	p, err := NewProvider(&flakyProvider{}, WithBackoff(100*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := p.backoff(attempt, errRateLimited)
+		if d < max/2 || d > max {
+			t.Errorf("attempt %d: backoff %v outside [%v, %v]", attempt, d, max/2, max)
+		}
+	}
+	hinted := &provider.Error{Kind: provider.ErrorKindRateLimited, RetryAfter: 5 * time.Second}
+	if d := p.backoff(0, hinted); d != 5*time.Second {
+		t.Errorf("expected the retry-after hint, got %v", d)
+	}
+}
+
+func TestRetryProvider_StreamRetriesBeforeFirstChunk(t *testing.T) {
+	fake := &flakyProvider{errs: []error{errRateLimited}, streamErrs: []error{errRateLimited}}
+	p := newTestProvider(t, fake)
+
+	stream, err := p.GenerateContentStream(context.Background(), "model", nil)
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	for resp, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		text += resp.Text()
+	}
+	if text != "ab" {
+		t.Errorf("expected %q, got %q", "ab", text)
+	}
+	if fake.calls != 3 || fake.streams != 2 {
+		t.Errorf("expected 3 calls and 2 streams, got %d and %d", fake.calls, fake.streams)
+	}
+}
+
+func TestRetryProvider_StreamNoRetryAfterChunk(t *testing.T) {
+	inner := &lateFailureProvider{}
+	p := newTestProvider(t, inner)
+
+	stream, err := p.GenerateContentStream(context.Background(), "model", nil)
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var chunks int
+	var streamErr error
+	for _, err := range stream.All() {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		chunks++
+	}
+	if !errors.Is(streamErr, errRateLimited) || chunks != 2 {
+		t.Errorf("expected the error after 2 chunks, got %v after %d", streamErr, chunks)
+	}
+	if inner.streams != 1 {
+		t.Errorf("expected the stream not to be reopened, got %d streams", inner.streams)
+	}
+}
+
+type lateFailureProvider struct {
+	flakyProvider
+}
+
+func (p *lateFailureProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	p.streams++
+	return &fakeStream{chunks: []string{"a", "b"}, err: errRateLimited, failLate: true}, nil
+}
+
+func TestNewProvider_InvalidOptions(t *testing.T) {
+	for _, o := range []Option{WithMaxAttempts(0), WithBackoff(0, time.Second), WithBackoff(time.Second, time.Millisecond), WithRetryIf(nil)} {
+		if _, err := NewProvider(&flakyProvider{}, o); err == nil {
+			t.Error("expected an error")
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package provider
+
+import "slices"
+
+// ToolCallAccumulator reassembles tool calls whose ID, name and JSON
+// arguments arrive in fragments across stream chunks. Fragments belonging to
+// the same call share an index, such as the OpenAI tool call index or the
+// Anthropic content block index.
+type ToolCallAccumulator struct {
+	order []int
+	calls map[int]*ToolCallPart
+}
+
+// Add merges a fragment into the call at index. Non-empty IDs and names
+// replace the stored ones; arguments are appended.
+func (a *ToolCallAccumulator) Add(index int, id, name, arguments string) {
+	if a.calls == nil {
+		a.calls = make(map[int]*ToolCallPart)
+	}
+	call, ok := a.calls[index]
+	if !ok {
+		call = &ToolCallPart{}
+		a.calls[index] = call
+		a.order = append(a.order, index)
+	}
+	if id != "" {
+		call.ID = id
+	}
+	if name != "" {
+		call.Name = name
+	}
+	call.Arguments += arguments
+}
+
+// Complete removes and returns the call at index.
+func (a *ToolCallAccumulator) Complete(index int) (ToolCallPart, bool) {
+	call, ok := a.calls[index]
+	if !ok {
+		return ToolCallPart{}, false
+	}
+	delete(a.calls, index)
+	a.order = slices.DeleteFunc(a.order, func(i int) bool { return i == index })
+	return finishToolCall(*call), true
+}
+
+// Flush removes and returns every pending call in the order it was started.
+func (a *ToolCallAccumulator) Flush() []ToolCallPart {
+	if len(a.order) == 0 {
+		return nil
+	}
+	calls := make([]ToolCallPart, 0, len(a.order))
+	for _, index := range a.order {
+		calls = append(calls, finishToolCall(*a.calls[index]))
+	}
+	a.order = nil
+	a.calls = nil
+	return calls
+}
+
+// Pending reports whether any call has been started but not completed.
+func (a *ToolCallAccumulator) Pending() bool {
+	return len(a.order) > 0
+}
+
+func finishToolCall(call ToolCallPart) ToolCallPart {
+	if call.Arguments == "" {
+		call.Arguments = "{}"
+	}
+	return call
+}
@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToolCallAccumulator(t *testing.T) {
+	var acc ToolCallAccumulator
+	acc.Add(0, "call_a", "search", "")
+	acc.Add(1, "call_b", "lookup", `{"id":`)
+	acc.Add(0, "", "", `{"query":`)
+	acc.Add(0, "", "", `"go"}`)
+	acc.Add(1, "", "", `7}`)
+	acc.Add(2, "call_c", "now", "")
+
+	call, ok := acc.Complete(1)
+	if !ok {
+		t.Fatal("expected call at index 1")
+	}
+	if want := (ToolCallPart{ID: "call_b", Name: "lookup", Arguments: `{"id":7}`}); call != want {
+		t.Errorf("Complete(1) = %+v, want %+v", call, want)
+	}
+	if _, ok := acc.Complete(1); ok {
+		t.Error("expected completed call to be removed")
+	}
+
+	want := []ToolCallPart{
+		{ID: "call_a", Name: "search", Arguments: `{"query":"go"}`},
+		{ID: "call_c", Name: "now", Arguments: "{}"},
+	}
+	if got := acc.Flush(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Flush() = %+v, want %+v", got, want)
+	}
+	if acc.Pending() {
+		t.Error("expected no pending calls after Flush")
+	}
+}
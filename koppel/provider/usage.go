@@ -0,0 +1,84 @@
+package provider
+
+// Usage is the normalized token accounting of a response. InputTokens counts
+// every prompt token, including those read from or written to a cache, and
+// OutputTokens counts every generated token, including thinking tokens.
+type Usage struct {
+	InputTokens         int64 `json:"input_tokens,omitempty"`
+	OutputTokens        int64 `json:"output_tokens,omitempty"`
+	ThinkingTokens      int64 `json:"thinking_tokens,omitempty"`
+	CachedInputTokens   int64 `json:"cached_input_tokens,omitempty"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+}
+
+// TotalTokens returns the sum of input and output tokens.
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// IsZero reports whether u carries no token counts.
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// Add returns the field-wise sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:         u.InputTokens + other.InputTokens,
+		OutputTokens:        u.OutputTokens + other.OutputTokens,
+		ThinkingTokens:      u.ThinkingTokens + other.ThinkingTokens,
+		CachedInputTokens:   u.CachedInputTokens + other.CachedInputTokens,
+		CacheCreationTokens: u.CacheCreationTokens + other.CacheCreationTokens,
+	}
+}
+
+// Sub returns the usage accumulated since an earlier total.
+func (u Usage) Sub(earlier Usage) Usage {
+	return Usage{
+		InputTokens:         u.InputTokens - earlier.InputTokens,
+		OutputTokens:        u.OutputTokens - earlier.OutputTokens,
+		ThinkingTokens:      u.ThinkingTokens - earlier.ThinkingTokens,
+		CachedInputTokens:   u.CachedInputTokens - earlier.CachedInputTokens,
+		CacheCreationTokens: u.CacheCreationTokens - earlier.CacheCreationTokens,
+	}
+}
+
+// Pricing holds the price of a model in currency units per million tokens.
+// Zero cache prices fall back to InputPerMillion.
+type Pricing struct {
+	InputPerMillion         float64 `json:"input_per_million"`
+	OutputPerMillion        float64 `json:"output_per_million"`
+	CachedInputPerMillion   float64 `json:"cached_input_per_million,omitempty"`
+	CacheCreationPerMillion float64 `json:"cache_creation_per_million,omitempty"`
+}
+
+// Cost returns the price of u.
+func (p Pricing) Cost(u Usage) float64 {
+	cachedPrice := p.CachedInputPerMillion
+	if cachedPrice == 0 {
+		cachedPrice = p.InputPerMillion
+	}
+	creationPrice := p.CacheCreationPerMillion
+	if creationPrice == 0 {
+		creationPrice = p.InputPerMillion
+	}
+
+	uncached := u.InputTokens - u.CachedInputTokens - u.CacheCreationTokens
+	cost := float64(uncached)*p.InputPerMillion +
+		float64(u.CachedInputTokens)*cachedPrice +
+		float64(u.CacheCreationTokens)*creationPrice +
+		float64(u.OutputTokens)*p.OutputPerMillion
+	return cost / 1e6
+}
+
+// PricingTable maps model names to their pricing.
+type PricingTable map[string]Pricing
+
+// Cost returns the price of u for model, or false if the model has no pricing.
+func (t PricingTable) Cost(model string, u Usage) (float64, bool) {
+	p, ok := t[model]
+	if !ok {
+		return 0, false
+	}
+	return p.Cost(u), true
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsage_Add(t *testing.T) {
+	a := Usage{InputTokens: 10, OutputTokens: 5, ThinkingTokens: 2, CachedInputTokens: 4, CacheCreationTokens: 1}
+	got := a.Add(a)
+	want := Usage{InputTokens: 20, OutputTokens: 10, ThinkingTokens: 4, CachedInputTokens: 8, CacheCreationTokens: 2}
+	if got != want {
+		t.Errorf("Add() = %+v, want %+v", got, want)
+	}
+	if got.TotalTokens() != 30 {
+		t.Errorf("TotalTokens() = %d, want 30", got.TotalTokens())
+	}
+	if !(Usage{}).IsZero() || got.IsZero() {
+		t.Error("unexpected IsZero result")
+	}
+	if diff := got.Sub(a); diff != a {
+		t.Errorf("Sub() = %+v, want %+v", diff, a)
+	}
+}
+
+func TestPricingTable_Cost(t *testing.T) {
+	table := PricingTable{
+		"model-a": {InputPerMillion: 3, OutputPerMillion: 15, CachedInputPerMillion: 0.3, CacheCreationPerMillion: 3.75},
+		"model-b": {InputPerMillion: 1, OutputPerMillion: 2},
+	}
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CachedInputTokens: 500_000, CacheCreationTokens: 100_000}
+
+	cost, ok := table.Cost("model-a", usage)
+	if !ok {
+		t.Fatal("expected pricing for model-a")
+	}
+	// 400k uncached * 3 + 500k cached * 0.3 + 100k creation * 3.75 + 100k output * 15
+	if want := 1.2 + 0.15 + 0.375 + 1.5; math.Abs(cost-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", cost, want)
+	}
+
+	cost, _ = table.Cost("model-b", usage)
+	if want := 1.0 + 0.2; math.Abs(cost-want) > 1e-9 {
+		t.Errorf("cost with fallback cache prices = %v, want %v", cost, want)
+	}
+
+	if _, ok := table.Cost("unknown", usage); ok {
+		t.Error("expected no pricing for unknown model")
+	}
+}
@@ -0,0 +1,196 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"gosuda.org/koppel/provider"
+)
+
+// TracedProvider records a span and metrics for every call of the provider
+// it wraps.
+type TracedProvider struct {
+	provider provider.Provider
+	name     string
+	inst     *instruments
+}
+
+var _ provider.Provider = (*TracedProvider)(nil)
+
+// NewProvider instruments p. providerName is reported as gen_ai.provider.name,
+// e.g. "openai", "anthropic" or "gcp.gemini".
+func NewProvider(p provider.Provider, providerName string, options ...Option) (*TracedProvider, error) {
+	inst, err := newInstruments(options)
+	if err != nil {
+		return nil, err
+	}
+	return &TracedProvider{provider: p, name: providerName, inst: inst}, nil
+}
+
+func (p *TracedProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	ctx, call := p.start(ctx, model, options)
+	resp, err := p.provider.GenerateContent(ctx, model, messages, options...)
+	if err != nil {
+		call.end(ctx, err)
+		return nil, err
+	}
+	call.observe(resp)
+	call.end(ctx, nil)
+	return resp, nil
+}
+
+func (p *TracedProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	ctx, call := p.start(ctx, model, options)
+	stream, err := p.provider.GenerateContentStream(ctx, model, messages, options...)
+	if err != nil {
+		call.end(ctx, err)
+		return nil, err
+	}
+	return &tracedStream{ctx: ctx, call: call, stream: stream}, nil
+}
+
+func (p *TracedProvider) start(ctx context.Context, model string, options []provider.Option) (context.Context, *call) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIOperationNameChat,
+		semconv.GenAIProviderNameKey.String(p.name),
+		semconv.GenAIRequestModel(model),
+	}
+	if opts, err := provider.NewOptions(options...); err == nil {
+		attrs = append(attrs, requestAttributes(opts)...)
+	}
+	ctx, span := p.inst.tracer.Start(ctx, "chat "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return ctx, &call{
+		inst:  p.inst,
+		span:  span,
+		start: time.Now(),
+		metricAttrs: []attribute.KeyValue{
+			semconv.GenAIOperationNameChat,
+			semconv.GenAIProviderNameKey.String(p.name),
+			semconv.GenAIRequestModel(model),
+		},
+	}
+}
+
+func requestAttributes(opts provider.Options) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if opts.Temperature != nil {
+		attrs = append(attrs, semconv.GenAIRequestTemperature(*opts.Temperature))
+	}
+	if opts.TopP != nil {
+		attrs = append(attrs, semconv.GenAIRequestTopP(*opts.TopP))
+	}
+	if opts.TopK != nil {
+		attrs = append(attrs, semconv.GenAIRequestTopK(float64(*opts.TopK)))
+	}
+	if opts.MaxOutputTokens > 0 {
+		attrs = append(attrs, semconv.GenAIRequestMaxTokens(opts.MaxOutputTokens))
+	}
+	if len(opts.StopSequences) > 0 {
+		attrs = append(attrs, semconv.GenAIRequestStopSequences(opts.StopSequences...))
+	}
+	if opts.Seed != nil {
+		attrs = append(attrs, semconv.GenAIRequestSeed(int(*opts.Seed)))
+	}
+	return attrs
+}
+
+// call is the state of one instrumented provider call.
+type call struct {
+	inst        *instruments
+	span        trace.Span
+	start       time.Time
+	metricAttrs []attribute.KeyValue
+
+	usage  provider.Usage
+	finish provider.FinishReason
+	chunks int
+	ended  bool
+}
+
+// observe records what a response or stream chunk reports.
+func (c *call) observe(resp provider.Response) {
+	if u := resp.Usage(); !u.IsZero() {
+		c.usage = u
+	}
+	if f := resp.FinishReason(); f != provider.FinishReasonUnspecified {
+		c.finish = f
+	}
+	for _, tc := range resp.ToolCalls() {
+		c.span.AddEvent("gen_ai.tool.call", trace.WithAttributes(
+			semconv.GenAIToolName(tc.Name),
+			semconv.GenAIToolCallID(tc.ID),
+		))
+	}
+}
+
+// end records the outcome of the call and ends its span. Only the first call
+// has an effect.
+func (c *call) end(ctx context.Context, err error) {
+	if c.ended {
+		return
+	}
+	c.ended = true
+
+	attrs := c.metricAttrs
+	if err != nil {
+		recordError(c.span, err)
+		attrs = append(attrs[:len(attrs):len(attrs)], errorType(err))
+	} else {
+		if c.finish != provider.FinishReasonUnspecified {
+			c.span.SetAttributes(semconv.GenAIResponseFinishReasons(string(c.finish)))
+		}
+		if !c.usage.IsZero() {
+			c.span.SetAttributes(usageAttributes(c.usage)...)
+			c.inst.tokenUsage.Record(ctx, c.usage.InputTokens, metric.WithAttributes(
+				append(attrs[:len(attrs):len(attrs)], semconv.GenAITokenTypeInput)...))
+			c.inst.tokenUsage.Record(ctx, c.usage.OutputTokens, metric.WithAttributes(
+				append(attrs[:len(attrs):len(attrs)], semconv.GenAITokenTypeOutput)...))
+		}
+	}
+	c.inst.duration.Record(ctx, time.Since(c.start).Seconds(), metric.WithAttributes(attrs...))
+	c.span.End()
+}
+
+type tracedStream struct {
+	ctx    context.Context
+	call   *call
+	stream provider.StreamResponse
+}
+
+func (s *tracedStream) Next() (provider.Response, error) {
+	resp, err := s.stream.Next()
+	switch {
+	case err == nil:
+		if s.call.chunks == 0 {
+			s.call.inst.timeToFirstChunk.Record(s.ctx, time.Since(s.call.start).Seconds(),
+				metric.WithAttributes(s.call.metricAttrs...))
+		}
+		s.call.chunks++
+		s.call.observe(resp)
+	case errors.Is(err, io.EOF):
+		s.call.end(s.ctx, nil)
+	default:
+		s.call.end(s.ctx, err)
+	}
+	return resp, err
+}
+
+func (s *tracedStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+// Close ends the span if the stream was not read to the end.
+func (s *tracedStream) Close() error {
+	err := s.stream.Close()
+	s.call.end(s.ctx, nil)
+	return err
+}
@@ -0,0 +1,246 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"iter"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gosuda.org/koppel/provider"
+)
+
+type fakeResponse struct {
+	text   string
+	calls  []provider.ToolCallPart
+	usage  provider.Usage
+	finish provider.FinishReason
+}
+
+func (r *fakeResponse) Text() string                        { return r.text }
+func (r *fakeResponse) Thought() string                     { return "" }
+func (r *fakeResponse) ToolCalls() []provider.ToolCallPart  { return r.calls }
+func (r *fakeResponse) Usage() provider.Usage               { return r.usage }
+func (r *fakeResponse) FinishReason() provider.FinishReason { return r.finish }
+
+// fakeProvider returns resp from GenerateContent and streams chunks.
+type fakeProvider struct {
+	resp   *fakeResponse
+	chunks []*fakeResponse
+	err    error
+}
+
+func (p *fakeProvider) GenerateContent(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.Response, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.resp, nil
+}
+
+func (p *fakeProvider) GenerateContentStream(ctx context.Context, model string, messages []provider.Message, options ...provider.Option) (provider.StreamResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &fakeStream{chunks: p.chunks}, nil
+}
+
+type fakeStream struct {
+	chunks []*fakeResponse
+}
+
+func (s *fakeStream) Next() (provider.Response, error) {
+	if len(s.chunks) == 0 {
+		return nil, io.EOF
+	}
+	c := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return c, nil
+}
+
+func (s *fakeStream) All() iter.Seq2[provider.Response, error] { return provider.Iterate(s) }
+func (s *fakeStream) Close() error                             { return nil }
+
+type testTelemetry struct {
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+	opts   []Option
+}
+
+func newTestTelemetry() *testTelemetry {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	return &testTelemetry{
+		spans:  spans,
+		reader: reader,
+		opts: []Option{
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))),
+			WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		},
+	}
+}
+
+// histogramCount returns the number of recordings of the named histogram
+// whose attributes include attr.
+func (tt *testTelemetry) histogramCount(t *testing.T, name string, attr attribute.KeyValue) uint64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := tt.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	var count uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+						count += dp.Count
+					}
+				}
+			case metricdata.Histogram[int64]:
+				for _, dp := range data.DataPoints {
+					if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+						count += dp.Count
+					}
+				}
+			}
+		}
+	}
+	return count
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracedProvider_GenerateContent(t *testing.T) {
+	tt := newTestTelemetry()
+	fake := &fakeProvider{resp: &fakeResponse{
+		text:   "hi",
+		calls:  []provider.ToolCallPart{{ID: "call_1", Name: "search"}},
+		usage:  provider.Usage{InputTokens: 12, OutputTokens: 7},
+		finish: provider.FinishReasonToolCalls,
+	}}
+	p, err := NewProvider(fake, "openai", tt.opts...)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	if _, err := p.GenerateContent(context.Background(), "gpt-4o", nil, provider.WithTemperature(0.2)); err != nil {
+		t.Fatalf("GenerateContent failed: %v", err)
+	}
+
+	spans := tt.spans.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "chat gpt-4o" {
+		t.Errorf("unexpected span name %q", span.Name())
+	}
+	for key, want := range map[attribute.Key]attribute.Value{
+		"gen_ai.operation.name":          attribute.StringValue("chat"),
+		"gen_ai.provider.name":           attribute.StringValue("openai"),
+		"gen_ai.request.model":           attribute.StringValue("gpt-4o"),
+		"gen_ai.request.temperature":     attribute.Float64Value(0.2),
+		"gen_ai.usage.input_tokens":      attribute.IntValue(12),
+		"gen_ai.usage.output_tokens":     attribute.IntValue(7),
+		"gen_ai.response.finish_reasons": attribute.StringSliceValue([]string{"tool_calls"}),
+	} {
+		if got, ok := spanAttr(span, key); !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != "gen_ai.tool.call" {
+		t.Errorf("expected one tool call event, got %v", events)
+	}
+
+	if n := tt.histogramCount(t, "gen_ai.client.operation.duration", attribute.String("gen_ai.request.model", "gpt-4o")); n != 1 {
+		t.Errorf("expected 1 duration recording, got %d", n)
+	}
+	if n := tt.histogramCount(t, "gen_ai.client.token.usage", attribute.String("gen_ai.token.type", "input")); n != 1 {
+		t.Errorf("expected 1 input token recording, got %d", n)
+	}
+}
+
+func TestTracedProvider_Error(t *testing.T) {
+	tt := newTestTelemetry()
+	fake := &fakeProvider{err: &provider.Error{Provider: "anthropic", Kind: provider.ErrorKindOverloaded, StatusCode: 529}}
+	p, err := NewProvider(fake, "anthropic", tt.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.GenerateContent(context.Background(), "claude", nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	span := tt.spans.Ended()[0]
+	if span.Status().Code != codes.Error {
+		t.Errorf("expected an error status, got %v", span.Status())
+	}
+	if v, _ := spanAttr(span, "error.type"); v.AsString() != "overloaded" {
+		t.Errorf("expected error.type overloaded, got %q", v.AsString())
+	}
+	if n := tt.histogramCount(t, "gen_ai.client.operation.duration", attribute.String("error.type", "overloaded")); n != 1 {
+		t.Errorf("expected a duration recording with error.type, got %d", n)
+	}
+}
+
+func TestTracedProvider_Stream(t *testing.T) {
+	tt := newTestTelemetry()
+	fake := &fakeProvider{chunks: []*fakeResponse{
+		{text: "Hel"},
+		{text: "lo", usage: provider.Usage{InputTokens: 4, OutputTokens: 2}, finish: provider.FinishReasonStop},
+	}}
+	p, err := NewProvider(fake, "gcp.gemini", tt.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := p.GenerateContentStream(context.Background(), "gemini-2.5-flash", nil)
+	if err != nil {
+		t.Fatalf("GenerateContentStream failed: %v", err)
+	}
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+	if len(tt.spans.Ended()) != 1 {
+		t.Fatal("expected the span to end with the stream")
+	}
+	stream.Close()
+	if len(tt.spans.Ended()) != 1 {
+		t.Error("expected Close not to end the span twice")
+	}
+
+	span := tt.spans.Ended()[0]
+	if v, _ := spanAttr(span, "gen_ai.usage.output_tokens"); v.AsInt64() != 2 {
+		t.Errorf("expected the final chunk's usage, got %v", v.Emit())
+	}
+	if n := tt.histogramCount(t, "gen_ai.client.operation.time_to_first_chunk", attribute.String("gen_ai.provider.name", "gcp.gemini")); n != 1 {
+		t.Errorf("expected 1 time to first chunk recording, got %d", n)
+	}
+}
+
+func TestNewProvider_InvalidOptions(t *testing.T) {
+	if _, err := NewProvider(&fakeProvider{}, "openai", WithTracerProvider(nil)); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := NewProvider(&fakeProvider{}, "openai", WithMeterProvider(nil)); err == nil {
+		t.Error("expected an error")
+	}
+}
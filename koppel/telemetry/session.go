@@ -0,0 +1,134 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"gosuda.org/koppel/chat"
+	"gosuda.org/koppel/provider"
+)
+
+// Session wraps a chat.Session so that every Send is recorded as an
+// invoke_agent span. Provider calls made by the session become its children
+// when the session's provider is a TracedProvider.
+type Session struct {
+	*chat.Session
+	inst *instruments
+}
+
+func NewSession(s *chat.Session, options ...Option) (*Session, error) {
+	inst, err := newInstruments(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Session: s, inst: inst}, nil
+}
+
+func (s *Session) Send(ctx context.Context, parts ...provider.Part) (provider.Response, error) {
+	ctx, turn := s.start(ctx)
+	resp, err := s.Session.Send(ctx, parts...)
+	if resp != nil {
+		turn.finish = resp.FinishReason()
+	}
+	turn.end(ctx, err)
+	return resp, err
+}
+
+func (s *Session) SendStream(ctx context.Context, parts ...provider.Part) (provider.StreamResponse, error) {
+	ctx, turn := s.start(ctx)
+	stream, err := s.Session.SendStream(ctx, parts...)
+	if err != nil {
+		turn.end(ctx, err)
+		return nil, err
+	}
+	return &sessionStream{ctx: ctx, turn: turn, stream: stream}, nil
+}
+
+func (s *Session) start(ctx context.Context) (context.Context, *turn) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIOperationNameInvokeAgent,
+		semconv.GenAIRequestModel(s.Model),
+	}
+	ctx, span := s.inst.tracer.Start(ctx, "invoke_agent",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+	return ctx, &turn{
+		session: s,
+		span:    span,
+		start:   time.Now(),
+		usage:   s.Usage,
+		attrs:   attrs,
+	}
+}
+
+// turn is the state of one instrumented Send.
+type turn struct {
+	session *Session
+	span    trace.Span
+	start   time.Time
+	usage   provider.Usage
+	attrs   []attribute.KeyValue
+	finish  provider.FinishReason
+	ended   bool
+}
+
+// end records the usage the turn added to the session and ends its span.
+// Only the first call has an effect.
+func (t *turn) end(ctx context.Context, err error) {
+	if t.ended {
+		return
+	}
+	t.ended = true
+
+	attrs := t.attrs
+	if err != nil {
+		recordError(t.span, err)
+		attrs = append(attrs[:len(attrs):len(attrs)], errorType(err))
+	}
+	if t.finish != provider.FinishReasonUnspecified {
+		t.span.SetAttributes(semconv.GenAIResponseFinishReasons(string(t.finish)))
+	}
+	if used := t.session.Usage.Sub(t.usage); !used.IsZero() {
+		t.span.SetAttributes(usageAttributes(used)...)
+	}
+	t.session.inst.duration.Record(ctx, time.Since(t.start).Seconds(), metric.WithAttributes(attrs...))
+	t.span.End()
+}
+
+type sessionStream struct {
+	ctx    context.Context
+	turn   *turn
+	stream provider.StreamResponse
+}
+
+func (s *sessionStream) Next() (provider.Response, error) {
+	resp, err := s.stream.Next()
+	switch {
+	case err == nil:
+		if f := resp.FinishReason(); f != provider.FinishReasonUnspecified {
+			s.turn.finish = f
+		}
+	case errors.Is(err, io.EOF):
+		s.turn.end(s.ctx, nil)
+	default:
+		s.turn.end(s.ctx, err)
+	}
+	return resp, err
+}
+
+func (s *sessionStream) All() iter.Seq2[provider.Response, error] {
+	return provider.Iterate(s)
+}
+
+func (s *sessionStream) Close() error {
+	err := s.stream.Close()
+	s.turn.end(s.ctx, nil)
+	return err
+}
@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gosuda.org/koppel/chat"
+	"gosuda.org/koppel/provider"
+)
+
+func TestSession_Send(t *testing.T) {
+	tt := newTestTelemetry()
+	fake := &fakeProvider{resp: &fakeResponse{
+		text:   "hello",
+		usage:  provider.Usage{InputTokens: 8, OutputTokens: 3},
+		finish: provider.FinishReasonStop,
+	}}
+	traced, err := NewProvider(fake, "openai", tt.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := chat.NewSession("gpt-4o")
+	inner.SetProvider(traced)
+	s, err := NewSession(inner, tt.opts...)
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+
+	for range 2 {
+		if _, err := s.Send(context.Background(), provider.TextPart("hi")); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	spans := tt.spans.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	chatSpan, agentSpan := spans[2], spans[3]
+	if agentSpan.Name() != "invoke_agent" {
+		t.Fatalf("expected the session span last, got %q", agentSpan.Name())
+	}
+	if chatSpan.Parent().SpanID() != agentSpan.SpanContext().SpanID() {
+		t.Error("expected the provider span to be a child of the session span")
+	}
+	if v, _ := spanAttr(agentSpan, "gen_ai.usage.input_tokens"); v.AsInt64() != 8 {
+		t.Errorf("expected the usage of the turn only, got %v", v.Emit())
+	}
+	if len(s.History) != 4 {
+		t.Errorf("expected the wrapped session's history to grow, got %d messages", len(s.History))
+	}
+	if n := tt.histogramCount(t, "gen_ai.client.operation.duration", attribute.String("gen_ai.operation.name", "invoke_agent")); n != 2 {
+		t.Errorf("expected 2 session duration recordings, got %d", n)
+	}
+}
+
+func TestSession_SendStream(t *testing.T) {
+	tt := newTestTelemetry()
+	fake := &fakeProvider{chunks: []*fakeResponse{
+		{text: "a"},
+		{text: "b", usage: provider.Usage{InputTokens: 5, OutputTokens: 2}, finish: provider.FinishReasonLength},
+	}}
+	inner := chat.NewSession("m")
+	inner.SetProvider(fake)
+	s, err := NewSession(inner, tt.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := s.SendStream(context.Background(), provider.TextPart("hi"))
+	if err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	defer stream.Close()
+	for _, err := range stream.All() {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+	}
+
+	spans := tt.spans.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if v, _ := spanAttr(spans[0], "gen_ai.response.finish_reasons"); len(v.AsStringSlice()) != 1 || v.AsStringSlice()[0] != "length" {
+		t.Errorf("unexpected finish reasons %v", v.Emit())
+	}
+	if v, _ := spanAttr(spans[0], "gen_ai.usage.output_tokens"); v.AsInt64() != 2 {
+		t.Errorf("expected the streamed usage, got %v", v.Emit())
+	}
+}
@@ -0,0 +1,122 @@
+// Package telemetry instruments providers and chat sessions with
+// OpenTelemetry spans and metrics following the GenAI semantic conventions.
+package telemetry
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+	"gosuda.org/koppel/provider"
+)
+
+const scopeName = "gosuda.org/koppel/telemetry"
+
+type Options struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+type Option func(*Options) error
+
+// WithTracerProvider sets the tracer provider. It defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) error {
+		if tp == nil {
+			return errors.New("telemetry: tracer provider must not be nil")
+		}
+		o.TracerProvider = tp
+		return nil
+	}
+}
+
+// WithMeterProvider sets the meter provider. It defaults to the global one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *Options) error {
+		if mp == nil {
+			return errors.New("telemetry: meter provider must not be nil")
+		}
+		o.MeterProvider = mp
+		return nil
+	}
+}
+
+// instruments holds the tracer and histograms shared by the wrappers.
+type instruments struct {
+	tracer           trace.Tracer
+	duration         metric.Float64Histogram
+	timeToFirstChunk metric.Float64Histogram
+	tokenUsage       metric.Int64Histogram
+}
+
+func newInstruments(options []Option) (*instruments, error) {
+	opts := Options{
+		TracerProvider: otel.GetTracerProvider(),
+		MeterProvider:  otel.GetMeterProvider(),
+	}
+	for _, o := range options {
+		if err := o(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	meter := opts.MeterProvider.Meter(scopeName)
+	duration, err := meter.Float64Histogram("gen_ai.client.operation.duration",
+		metric.WithDescription("Duration of GenAI client operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	timeToFirstChunk, err := meter.Float64Histogram("gen_ai.client.operation.time_to_first_chunk",
+		metric.WithDescription("Time until the first chunk of a streamed reply was received."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	tokenUsage, err := meter.Int64Histogram("gen_ai.client.token.usage",
+		metric.WithDescription("Number of input and output tokens used."),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		return nil, err
+	}
+	return &instruments{
+		tracer:           opts.TracerProvider.Tracer(scopeName),
+		duration:         duration,
+		timeToFirstChunk: timeToFirstChunk,
+		tokenUsage:       tokenUsage,
+	}, nil
+}
+
+func usageAttributes(u provider.Usage) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIUsageInputTokens(int(u.InputTokens)),
+		semconv.GenAIUsageOutputTokens(int(u.OutputTokens)),
+	}
+	if u.CachedInputTokens > 0 {
+		attrs = append(attrs, semconv.GenAIUsageCacheReadInputTokens(int(u.CachedInputTokens)))
+	}
+	if u.CacheCreationTokens > 0 {
+		attrs = append(attrs, semconv.GenAIUsageCacheCreationInputTokens(int(u.CacheCreationTokens)))
+	}
+	return attrs
+}
+
+// errorType returns the error.type value for err: the kind of a
+// provider.Error, or _OTHER.
+func errorType(err error) attribute.KeyValue {
+	var perr *provider.Error
+	if errors.As(err, &perr) {
+		return semconv.ErrorTypeKey.String(string(perr.Kind))
+	}
+	return semconv.ErrorTypeOther
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.SetAttributes(errorType(err))
+}
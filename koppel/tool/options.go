@@ -0,0 +1,75 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Risk classifies what a tool can affect, so that callers can ask for
+// approval before running the riskier ones.
+type Risk int
+
+const (
+	// RiskUnspecified is the risk of tools registered without one. It is
+	// treated like RiskMutating.
+	RiskUnspecified Risk = iota
+	// RiskReadOnly tools only read state and are safe to run unattended.
+	RiskReadOnly
+	// RiskMutating tools change state, such as writing files or running
+	// commands.
+	RiskMutating
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskReadOnly:
+		return "read_only"
+	case RiskMutating:
+		return "mutating"
+	}
+	return "unspecified"
+}
+
+// Options configures how a registered tool is executed.
+type Options struct {
+	// Timeout bounds a single call of the tool; zero means no limit.
+	Timeout time.Duration
+	// Sequential keeps the tool from running concurrently with other
+	// calls, for tools with side effects that must not interleave.
+	Sequential bool
+	Risk       Risk
+}
+
+type Option func(*Options) error
+
+// WithTimeout bounds each call of the tool to d.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return errors.New("tool: timeout must be positive")
+		}
+		o.Timeout = d
+		return nil
+	}
+}
+
+// WithSequential marks the tool as unsafe to run concurrently with other
+// calls.
+func WithSequential() Option {
+	return func(o *Options) error {
+		o.Sequential = true
+		return nil
+	}
+}
+
+// WithRisk sets the risk level of the tool.
+func WithRisk(r Risk) Option {
+	return func(o *Options) error {
+		if r < RiskUnspecified || r > RiskMutating {
+			return fmt.Errorf("tool: unknown risk level %d", r)
+		}
+		o.Risk = r
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Options(t *testing.T) {
+	r := NewRegistry()
+	h := func(ctx context.Context, arguments string) (string, error) { return "", nil }
+	if err := r.Add(Definition{Name: "write"}, h, WithSequential(), WithTimeout(time.Second)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	opts, ok := r.Options("write")
+	if !ok || !opts.Sequential || opts.Timeout != time.Second {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if _, ok := r.Options("missing"); ok {
+		t.Error("expected no options for an unknown tool")
+	}
+	if err := r.Add(Definition{Name: "bad"}, h, WithTimeout(0)); err == nil {
+		t.Error("expected an error for a zero timeout")
+	}
+
+	if err := r.Add(Definition{Name: "read"}, h, WithRisk(RiskReadOnly)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if opts, _ := r.Options("read"); opts.Risk != RiskReadOnly {
+		t.Errorf("expected a read-only tool, got %v", opts.Risk)
+	}
+	if err := r.Add(Definition{Name: "risky"}, h, WithRisk(Risk(9))); err == nil {
+		t.Error("expected an error for an unknown risk level")
+	}
+}
+
+func TestRegistry_CallTimeout(t *testing.T) {
+	r := NewRegistry()
+	err := r.Add(Definition{Name: "slow"}, func(ctx context.Context, arguments string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Add(Definition{Name: "stuck"}, func(ctx context.Context, arguments string) (string, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	}, WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"slow", "stuck"} {
+		start := time.Now()
+		_, err := r.Call(context.Background(), name, "")
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("%s: expected a timeout, got %v", name, err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: expected the call to return at the timeout", name)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Call(ctx, "slow", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the parent cancellation, got %v", err)
+	}
+}
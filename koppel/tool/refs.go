@@ -0,0 +1,161 @@
+package tool
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// InlineRefs returns a copy of schema with every $ref replaced by the
+// definition it points to and $defs removed, for providers that do not
+// accept references. Recursive definitions are expanded at most maxDepth
+// times along any path, counting the root itself for references to "#"; a
+// property or array that would recurse deeper is left out, and dropped from
+// its object's required list.
+func InlineRefs(schema map[string]interface{}, maxDepth int) (map[string]interface{}, error) {
+	defs, _ := schema["$defs"].(map[string]interface{})
+	// The root is already one expansion of "#".
+	in := &inliner{root: schema, defs: defs, maxDepth: maxDepth, depth: map[string]int{"#": 1}}
+	out, ok, err := in.inline(schema)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("schema recurses beyond depth %d", maxDepth)
+	}
+	return out.(map[string]interface{}), nil
+}
+
+// HasRefs reports whether schema contains a $ref anywhere.
+func HasRefs(schema interface{}) bool {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		if _, ok := v["$ref"]; ok {
+			return true
+		}
+		for _, child := range v {
+			if HasRefs(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if HasRefs(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type inliner struct {
+	root     map[string]interface{}
+	defs     map[string]interface{}
+	maxDepth int
+	// depth counts the expansions of each reference on the current path.
+	depth map[string]int
+}
+
+// inline copies node with references expanded. It reports false if node
+// cannot be expanded within the depth limit and should be left out.
+func (in *inliner) inline(node interface{}) (interface{}, bool, error) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			return in.expand(ref, v)
+		}
+		return in.inlineObject(v)
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, child := range v {
+			c, ok, err := in.inline(child)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out = append(out, c)
+			}
+		}
+		return out, true, nil
+	}
+	return node, true, nil
+}
+
+func (in *inliner) expand(ref string, node map[string]interface{}) (interface{}, bool, error) {
+	var target map[string]interface{}
+	switch {
+	case ref == "#":
+		target = in.root
+	case strings.HasPrefix(ref, "#/$defs/"):
+		target, _ = in.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+	}
+	if target == nil {
+		return nil, false, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	if in.depth[ref] >= in.maxDepth {
+		return nil, false, nil
+	}
+
+	in.depth[ref]++
+	defer func() { in.depth[ref]-- }()
+	out, ok, err := in.inlineObject(target)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	merged := out.(map[string]interface{})
+	// Keywords next to the $ref, such as a field description, win.
+	for k, v := range node {
+		if k != "$ref" {
+			merged[k] = v
+		}
+	}
+	return merged, true, nil
+}
+
+func (in *inliner) inlineObject(v map[string]interface{}) (interface{}, bool, error) {
+	out := make(map[string]interface{}, len(v))
+	var dropped []string
+	for k, child := range v {
+		switch k {
+		case "$defs":
+			continue
+		case "properties":
+			props, ok := child.(map[string]interface{})
+			if !ok {
+				out[k] = child
+				continue
+			}
+			inlined := make(map[string]interface{}, len(props))
+			for name, prop := range props {
+				p, ok, err := in.inline(prop)
+				if err != nil {
+					return nil, false, err
+				}
+				if !ok {
+					dropped = append(dropped, name)
+					continue
+				}
+				inlined[name] = p
+			}
+			out[k] = inlined
+		default:
+			c, ok, err := in.inline(child)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				// An array or map whose items recurse too deep.
+				return nil, false, nil
+			}
+			out[k] = c
+		}
+	}
+	if len(dropped) > 0 {
+		if req := requiredNames(out); req != nil {
+			out["required"] = slices.DeleteFunc(slices.Clone(req), func(name string) bool {
+				return slices.Contains(dropped, name)
+			})
+		}
+	}
+	return out, true, nil
+}
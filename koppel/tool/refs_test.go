@@ -0,0 +1,102 @@
+package tool
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInlineRefs(t *testing.T) {
+	schema, err := GenerateSchema(thread{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inlined, err := InlineRefs(schema, 2)
+	if err != nil {
+		t.Fatalf("InlineRefs failed: %v", err)
+	}
+	if HasRefs(inlined) {
+		t.Fatal("expected every reference to be inlined")
+	}
+	if _, ok := inlined["$defs"]; ok {
+		t.Error("expected $defs to be removed")
+	}
+
+	props := inlined["properties"].(map[string]interface{})
+	owner := props["owner"].(map[string]interface{})
+	if owner["type"] != "object" || owner["description"] != "thread owner" {
+		t.Errorf("expected the User definition with the field description, got %v", owner)
+	}
+
+	// comments -> Comment -> replies -> Comment; a third level is cut off.
+	comment := props["comments"].(map[string]interface{})["items"].(map[string]interface{})
+	reply := comment["properties"].(map[string]interface{})["replies"].(map[string]interface{})["items"].(map[string]interface{})
+	replyProps := reply["properties"].(map[string]interface{})
+	if _, ok := replyProps["replies"]; ok {
+		t.Error("expected recursion beyond the depth limit to be dropped")
+	}
+	if _, ok := replyProps["author"]; !ok {
+		t.Error("expected non-recursive properties to be kept")
+	}
+
+	if !HasRefs(schema) {
+		t.Error("expected the original schema to be left untouched")
+	}
+}
+
+func TestInlineRefs_DropsRequired(t *testing.T) {
+	schema, err := GenerateSchema(struct {
+		Root treeNode `json:"root"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make the recursive property required to check it is removed.
+	def := schema["$defs"].(map[string]interface{})["treeNode"].(map[string]interface{})
+	def["required"] = []string{"value", "children"}
+
+	inlined, err := InlineRefs(schema, 1)
+	if err != nil {
+		t.Fatalf("InlineRefs failed: %v", err)
+	}
+	root := inlined["properties"].(map[string]interface{})["root"].(map[string]interface{})
+	if !reflect.DeepEqual(root["required"], []string{"value"}) {
+		t.Errorf("expected children to be dropped from required, got %v", root["required"])
+	}
+}
+
+func TestInlineRefs_Unresolvable(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"a": map[string]interface{}{"$ref": "#/$defs/Missing"}},
+	}
+	if _, err := InlineRefs(schema, 3); err == nil {
+		t.Error("expected an error for an unknown reference")
+	}
+}
+
+func TestInlineRefs_RecursiveRoot(t *testing.T) {
+	schema, err := GenerateSchema(treeNode{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inlined, err := InlineRefs(schema, 2)
+	if err != nil {
+		t.Fatalf("InlineRefs failed: %v", err)
+	}
+	if HasRefs(inlined) {
+		t.Fatal("expected every reference to be inlined")
+	}
+
+	// The root counts as the first level, so only its children are expanded.
+	props := inlined["properties"].(map[string]interface{})
+	child := props["children"].(map[string]interface{})["items"].(map[string]interface{})
+	childProps := child["properties"].(map[string]interface{})
+	if _, ok := childProps["children"]; ok {
+		t.Error("expected recursion beyond the depth limit to be dropped")
+	}
+	if _, ok := childProps["value"]; !ok {
+		t.Error("expected non-recursive properties to be kept")
+	}
+}
@@ -0,0 +1,239 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownTool is returned by Registry.Call for names that were never registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// Handler executes a tool with its raw JSON arguments and returns the content
+// sent back to the model.
+type Handler func(ctx context.Context, arguments string) (string, error)
+
+// Validator can be implemented by tool input types to check decoded arguments.
+type Validator interface {
+	Validate() error
+}
+
+type entry struct {
+	definition Definition
+	handler    Handler
+	options    Options
+	// schema is the normalized input schema arguments are validated
+	// against, or nil if the definition has none.
+	schema map[string]interface{}
+}
+
+// Registry binds tool definitions to the handlers that execute them.
+type Registry struct {
+	names   []string
+	entries map[string]*entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]*entry)}
+}
+
+// Add registers def with an untyped handler.
+func (r *Registry) Add(def Definition, h Handler, options ...Option) error {
+	if def.Name == "" {
+		return errors.New("tool: definition has no name")
+	}
+	if h == nil {
+		return fmt.Errorf("tool %s: nil handler", def.Name)
+	}
+	if _, ok := r.entries[def.Name]; ok {
+		return fmt.Errorf("tool %s: already registered", def.Name)
+	}
+	e := &entry{definition: def, handler: h}
+	for _, o := range options {
+		if err := o(&e.options); err != nil {
+			return fmt.Errorf("tool %s: %w", def.Name, err)
+		}
+	}
+	if def.InputSchema != nil {
+		schema, err := NormalizeSchema(def.InputSchema)
+		if err != nil {
+			return fmt.Errorf("tool %s: %w", def.Name, err)
+		}
+		e.schema = schema
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]*entry)
+	}
+	r.names = append(r.names, def.Name)
+	r.entries[def.Name] = e
+	return nil
+}
+
+// Register adds a typed tool to r. The input schema is derived from In,
+// arguments are decoded and validated into In before fn runs, and the result
+// is serialized to JSON unless Out is a string.
+func Register[In, Out any](r *Registry, name, description string, fn func(context.Context, In) (Out, error), options ...Option) error {
+	var zero In
+	def, err := FromStruct(name, description, zero)
+	if err != nil {
+		return fmt.Errorf("tool %s: %w", name, err)
+	}
+	schema := def.InputSchema.(map[string]interface{})
+
+	return r.Add(def, func(ctx context.Context, arguments string) (string, error) {
+		var in In
+		if err := DecodeArguments(arguments, schema, &in); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		out, err := fn(ctx, in)
+		if err != nil {
+			return "", err
+		}
+		return encodeResult(out)
+	}, options...)
+}
+
+// Definitions returns the registered definitions in registration order,
+// ready to be passed as provider options.
+func (r *Registry) Definitions() []Definition {
+	defs := make([]Definition, len(r.names))
+	for i, name := range r.names {
+		defs[i] = r.entries[name].definition
+	}
+	return defs
+}
+
+// Lookup returns the definition registered under name.
+func (r *Registry) Lookup(name string) (Definition, bool) {
+	e, ok := r.entries[name]
+	if !ok {
+		return Definition{}, false
+	}
+	return e.definition, true
+}
+
+// Options returns the execution options name was registered with.
+func (r *Registry) Options(name string) (Options, bool) {
+	e, ok := r.entries[name]
+	if !ok {
+		return Options{}, false
+	}
+	return e.options, true
+}
+
+// Len reports the number of registered tools.
+func (r *Registry) Len() int {
+	return len(r.names)
+}
+
+// Call executes the tool registered under name with the given JSON arguments.
+// Arguments that do not match the tool's input schema are rejected with a
+// *ValidationError before the handler runs. Call is safe for concurrent use
+// as long as the handlers are.
+func (r *Registry) Call(ctx context.Context, name, arguments string) (string, error) {
+	e, ok := r.entries[name]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownTool, name)
+	}
+	if e.schema != nil {
+		if err := validateArguments(arguments, e.schema); err != nil {
+			return "", err
+		}
+	}
+	if e.options.Timeout <= 0 {
+		return e.handler(ctx, arguments)
+	}
+	return callWithTimeout(ctx, e, arguments)
+}
+
+// callWithTimeout runs the handler of e under its timeout. A handler that
+// ignores its context is abandoned once the timeout expires.
+func callWithTimeout(ctx context.Context, e *entry, arguments string) (string, error) {
+	tctx, cancel := context.WithTimeout(ctx, e.options.Timeout)
+	defer cancel()
+
+	type result struct {
+		content string
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		content, err := e.handler(tctx, arguments)
+		done <- result{content, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("timed out after %v: %w", e.options.Timeout, res.err)
+		}
+		return res.content, res.err
+	case <-tctx.Done():
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("timed out after %v: %w", e.options.Timeout, tctx.Err())
+	}
+}
+
+// DecodeArguments strictly decodes JSON arguments into v, checks that every
+// property listed as required in schema is present and runs v's Validate
+// method if it has one.
+func DecodeArguments(arguments string, schema map[string]interface{}, v interface{}) error {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return err
+	}
+	for _, name := range requiredNames(schema) {
+		if _, ok := raw[name]; !ok {
+			return fmt.Errorf("missing required property %q", name)
+		}
+	}
+
+	dec := json.NewDecoder(strings.NewReader(arguments))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	if val, ok := v.(Validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+func requiredNames(schema map[string]interface{}) []string {
+	switch req := schema["required"].(type) {
+	case []string:
+		return req
+	case []interface{}:
+		names := make([]string, 0, len(req))
+		for _, r := range req {
+			if s, ok := r.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func encodeResult(out interface{}) (string, error) {
+	switch v := out.(type) {
+	case string:
+		return v, nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("encode result: %w", err)
+	}
+	return string(b), nil
+}
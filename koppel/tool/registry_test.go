@@ -0,0 +1,132 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type searchInput struct {
+	Query string `json:"query" description:"search terms"`
+	Limit *int   `json:"limit"`
+}
+
+func (in searchInput) Validate() error {
+	if in.Limit != nil && *in.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+type searchOutput struct {
+	Results []string `json:"results"`
+}
+
+func newSearchRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	err := Register(r, "search", "search the web", func(ctx context.Context, in searchInput) (searchOutput, error) {
+		return searchOutput{Results: []string{"result for " + in.Query}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	return r
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := newSearchRegistry(t)
+
+	defs := r.Definitions()
+	if len(defs) != 1 || defs[0].Name != "search" {
+		t.Fatalf("unexpected definitions: %+v", defs)
+	}
+	schema := defs[0].InputSchema.(map[string]interface{})
+	props := schema["properties"].(map[string]interface{})
+	if _, ok := props["query"]; !ok {
+		t.Errorf("expected query property in schema, got %+v", props)
+	}
+
+	out, err := r.Call(context.Background(), "search", `{"query":"gophers"}`)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if out != `{"results":["result for gophers"]}` {
+		t.Errorf("unexpected result: %s", out)
+	}
+
+	if _, err := r.Call(context.Background(), "search", `{"query":"gophers","limit":null}`); err != nil {
+		t.Errorf("expected a null optional argument to be accepted, got %v", err)
+	}
+}
+
+func TestRegistry_CallErrors(t *testing.T) {
+	r := newSearchRegistry(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		tool      string
+		arguments string
+		want      string
+	}{
+		{"unknown tool", "missing", `{}`, "unknown tool"},
+		{"malformed json", "search", `{"query":`, "invalid arguments"},
+		{"missing required", "search", `{}`, `missing required property "query"`},
+		{"unknown field", "search", `{"query":"x","page":2}`, `unknown property "page"`},
+		{"validator", "search", `{"query":"x","limit":0}`, "limit must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Call(ctx, tt.tool, tt.arguments)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := r.Call(ctx, "missing", ""); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("expected ErrUnknownTool, got %v", err)
+	}
+}
+
+func TestRegistry_AddDuplicate(t *testing.T) {
+	r := newSearchRegistry(t)
+	err := r.Add(Definition{Name: "search"}, func(ctx context.Context, arguments string) (string, error) {
+		return "", nil
+	})
+	if err == nil {
+		t.Error("expected error registering duplicate tool")
+	}
+}
+
+func TestRegistry_CallValidatesArguments(t *testing.T) {
+	r := NewRegistry()
+	called := false
+	err := r.Add(Definition{
+		Name:        "echo",
+		InputSchema: `{"type":"object","properties":{"n":{"type":"integer"}},"required":["n"]}`,
+	}, func(ctx context.Context, arguments string) (string, error) {
+		called = true
+		return arguments, nil
+	})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	_, err = r.Call(context.Background(), "echo", `{"n":"one"}`)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Issues) != 1 || verr.Issues[0].Path != "n" {
+		t.Errorf("expected a ValidationError for n, got %v", err)
+	}
+	if called {
+		t.Error("expected the handler not to run for invalid arguments")
+	}
+
+	if err := r.Add(Definition{Name: "broken", InputSchema: "[]"}, func(ctx context.Context, arguments string) (string, error) {
+		return "", nil
+	}); err == nil {
+		t.Error("expected an error registering an invalid schema")
+	}
+}
@@ -0,0 +1,91 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NormalizeSchema returns a fresh copy of a JSON Schema given as a map, as
+// JSON text (json.RawMessage, []byte or string) or as any value that
+// marshals to a schema, such as a typed schema struct. The copy holds only
+// the plain JSON types, so providers can rewrite it freely. A nil schema
+// becomes an object schema without properties.
+func NormalizeSchema(schema interface{}) (map[string]interface{}, error) {
+	var data []byte
+	switch v := schema.(type) {
+	case nil:
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}, nil
+	case json.RawMessage:
+		data = v
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		b, err := json.Marshal(schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
+		}
+		data = b
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if out == nil {
+		return nil, fmt.Errorf("invalid schema: expected a JSON object")
+	}
+	return out, nil
+}
+
+// WalkSchema calls fn for schema and every subschema nested in it, parents
+// before children. fn may modify the schema it is given; subschemas are
+// looked up after fn returns.
+func WalkSchema(schema map[string]interface{}, fn func(map[string]interface{})) {
+	fn(schema)
+	for key, child := range schema {
+		switch key {
+		case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+			if m, ok := child.(map[string]interface{}); ok {
+				for _, sub := range m {
+					if s, ok := sub.(map[string]interface{}); ok {
+						WalkSchema(s, fn)
+					}
+				}
+			}
+		case "items", "additionalProperties", "not", "if", "then", "else", "contains", "propertyNames":
+			if s, ok := child.(map[string]interface{}); ok {
+				WalkSchema(s, fn)
+			}
+		case "anyOf", "oneOf", "allOf", "prefixItems":
+			if list, ok := child.([]interface{}); ok {
+				for _, sub := range list {
+					if s, ok := sub.(map[string]interface{}); ok {
+						WalkSchema(s, fn)
+					}
+				}
+			}
+		}
+	}
+}
+
+// SchemaTypes returns the types allowed by a schema's type keyword, which
+// may be a single name or a list.
+func SchemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	case []string:
+		return t
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package tool
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSchema(t *testing.T) {
+	want := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}},
+		"required":   []interface{}{"a"},
+	}
+	typed := struct {
+		Type       string                       `json:"type"`
+		Properties map[string]map[string]string `json:"properties"`
+		Required   []string                     `json:"required"`
+	}{"object", map[string]map[string]string{"a": {"type": "string"}}, []string{"a"}}
+
+	for name, schema := range map[string]interface{}{
+		"map": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"a": map[string]interface{}{"type": "string"}},
+			"required":   []string{"a"},
+		},
+		"raw":    json.RawMessage(`{"type":"object","properties":{"a":{"type":"string"}},"required":["a"]}`),
+		"string": `{"type":"object","properties":{"a":{"type":"string"}},"required":["a"]}`,
+		"typed":  typed,
+	} {
+		got, err := NormalizeSchema(schema)
+		if err != nil {
+			t.Fatalf("%s: NormalizeSchema failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: NormalizeSchema = %v, want %v", name, got, want)
+		}
+	}
+
+	for _, schema := range []interface{}{json.RawMessage(`null`), "[]", 42, make(chan int)} {
+		if _, err := NormalizeSchema(schema); err == nil {
+			t.Errorf("expected an error for %v", schema)
+		}
+	}
+}
+
+func TestWalkSchema(t *testing.T) {
+	schema, err := NormalizeSchema(`{
+		"type": "object",
+		"properties": {
+			"list": {"type": "array", "items": {"type": "string"}},
+			"either": {"anyOf": [{"type": "integer"}, {"type": "null"}]},
+			"map": {"type": "object", "additionalProperties": {"type": "boolean"}}
+		},
+		"$defs": {"Node": {"type": "number"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	WalkSchema(schema, func(s map[string]interface{}) {
+		for _, typ := range SchemaTypes(s) {
+			seen[typ]++
+		}
+	})
+	want := map[string]int{"object": 2, "array": 1, "string": 1, "integer": 1, "null": 1, "boolean": 1, "number": 1}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("visited types %v, want %v", seen, want)
+	}
+}
@@ -1,9 +1,12 @@
 package tool
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Definition represents a tool's metadata and interface.
@@ -13,9 +16,27 @@ type Definition struct {
 	InputSchema interface{} `json:"input_schema"`
 }
 
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
 // GenerateSchema generates a JSON Schema from a Go struct using reflection.
+//
+// Fields follow encoding/json: the json tag names them, "-" skips them and
+// embedded structs are flattened. Pointer and omitempty fields are optional.
+// The description, enum (comma separated), minimum, maximum, pattern,
+// format, default and example tags add the matching schema keywords; for
+// slices, enum, minimum, maximum, pattern and format apply to the items.
+//
+// Named struct types other than v's own are emitted once under $defs and
+// referenced with $ref, so recursive types are supported; a reference back
+// to v's type is "#".
 func GenerateSchema(v interface{}) (map[string]interface{}, error) {
 	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("GenerateSchema: expected struct, got nil")
+	}
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
@@ -23,59 +44,172 @@ func GenerateSchema(v interface{}) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("GenerateSchema: expected struct, got %v", t.Kind())
 	}
 
-	schema := map[string]interface{}{
-		"type":       "object",
-		"properties": make(map[string]interface{}),
+	g := &schemaGenerator{
+		root:  t,
+		names: make(map[reflect.Type]string),
+		taken: make(map[string]bool),
+		defs:  make(map[string]interface{}),
+	}
+	schema, err := g.structSchema(t)
+	if err != nil {
+		return nil, err
 	}
+	if len(g.defs) > 0 {
+		schema["$defs"] = g.defs
+	}
+	return schema, nil
+}
+
+// schemaGenerator tracks the named struct types of one GenerateSchema call.
+type schemaGenerator struct {
+	root  reflect.Type
+	names map[reflect.Type]string
+	taken map[string]bool
+	defs  map[string]interface{}
+}
 
+func (g *schemaGenerator) structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
 	required := []string{}
-	properties := schema["properties"].(map[string]interface{})
+	if err := g.addFields(t, properties, &required, false, map[reflect.Type]bool{t: true}); err != nil {
+		return nil, err
+	}
 
+	// Struct arguments are decoded strictly, so unknown properties are
+	// ruled out here to be reported by validation.
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// refSchema returns a reference to the definition of named struct type t,
+// generating the definition on first use.
+func (g *schemaGenerator) refSchema(t reflect.Type) (map[string]interface{}, error) {
+	if t == g.root {
+		return map[string]interface{}{"$ref": "#"}, nil
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = g.defName(t)
+		g.names[t] = name
+		// Registering the name before recursing ends cycles at the ref.
+		def, err := g.structSchema(t)
+		if err != nil {
+			return nil, err
+		}
+		g.defs[name] = def
+	}
+	return map[string]interface{}{"$ref": "#/$defs/" + name}, nil
+}
+
+// defName returns a unique definition name for t, derived from its Go name.
+func (g *schemaGenerator) defName(t reflect.Type) string {
+	base := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	name := base
+	for i := 2; g.taken[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	g.taken[name] = true
+	return name
+}
+
+// addFields adds the properties of struct t. Fields of embedded structs are
+// added after the direct fields so that, as in encoding/json, a direct field
+// hides an embedded one of the same name. optional marks every field as not
+// required, for fields reached through an embedded pointer. seen holds the
+// structs being flattened, to stop at embedding cycles.
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string, optional bool, seen map[reflect.Type]bool) error {
+	var embedded []reflect.StructField
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		jsonTag := field.Tag.Get("json")
 		if jsonTag == "-" {
 			continue
 		}
+		name, tagOpts, _ := strings.Cut(jsonTag, ",")
 
-		name := field.Name
-		if jsonTag != "" {
-			parts := strings.Split(jsonTag, ",")
-			if parts[0] != "" {
-				name = parts[0]
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, field)
+				continue
 			}
 		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
 
-		prop, req, err := getTypeSchema(field.Type)
+		prop, req, err := g.typeSchema(field.Type)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("field %s: %w", field.Name, err)
 		}
-
-		// Add description from tag if present
-		if desc := field.Tag.Get("description"); desc != "" {
-			prop["description"] = desc
+		if err := applyTags(prop, field); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		for _, opt := range strings.Split(tagOpts, ",") {
+			if opt == "omitempty" || opt == "omitzero" {
+				req = false
+			}
 		}
 
 		properties[name] = prop
-		if req {
-			required = append(required, name)
+		if req && !optional {
+			*required = append(*required, name)
 		}
 	}
 
-	if len(required) > 0 {
-		schema["required"] = required
+	for _, field := range embedded {
+		ft := field.Type
+		pointer := ft.Kind() == reflect.Ptr
+		if pointer {
+			ft = ft.Elem()
+		}
+		if seen[ft] {
+			continue
+		}
+		seen[ft] = true
+		if err := g.addFields(ft, properties, required, optional || pointer, seen); err != nil {
+			return err
+		}
 	}
-
-	return schema, nil
+	return nil
 }
 
-func getTypeSchema(t reflect.Type) (map[string]interface{}, bool, error) {
+func (g *schemaGenerator) typeSchema(t reflect.Type) (map[string]interface{}, bool, error) {
 	required := true // Default to required unless it's a pointer or has omitempty
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 		required = false
 	}
 
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, required, nil
+	case rawMessageType:
+		// Any JSON value.
+		return map[string]interface{}{}, required, nil
+	}
+
 	switch t.Kind() {
 	case reflect.String:
 		return map[string]interface{}{"type": "string"}, required, nil
@@ -86,8 +220,14 @@ func getTypeSchema(t reflect.Type) (map[string]interface{}, bool, error) {
 		return map[string]interface{}{"type": "number"}, required, nil
 	case reflect.Bool:
 		return map[string]interface{}{"type": "boolean"}, required, nil
-	case reflect.Slice:
-		items, _, err := getTypeSchema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}, required, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings.
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, required, nil
+		}
+		items, _, err := g.typeSchema(t.Elem())
 		if err != nil {
 			return nil, false, err
 		}
@@ -95,47 +235,104 @@ func getTypeSchema(t reflect.Type) (map[string]interface{}, bool, error) {
 			"type":  "array",
 			"items": items,
 		}, required, nil
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, false, fmt.Errorf("unsupported map key type: %v", t.Key().Kind())
+		}
+		values, _, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, false, err
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": values,
+		}, required, nil
 	case reflect.Struct:
-		schema := map[string]interface{}{
-			"type":       "object",
-			"properties": make(map[string]interface{}),
+		if t.Name() == "" {
+			schema, err := g.structSchema(t)
+			return schema, required, err
 		}
-		requiredFields := []string{}
-		properties := schema["properties"].(map[string]interface{})
+		schema, err := g.refSchema(t)
+		return schema, required, err
+	default:
+		return nil, false, fmt.Errorf("unsupported type: %v", t.Kind())
+	}
+}
 
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			jsonTag := field.Tag.Get("json")
-			if jsonTag == "-" {
-				continue
-			}
-			name := field.Name
-			if jsonTag != "" {
-				parts := strings.Split(jsonTag, ",")
-				if parts[0] != "" {
-					name = parts[0]
-				}
-			}
+// applyTags adds the schema keywords given by the struct tags of field.
+func applyTags(schema map[string]interface{}, field reflect.StructField) error {
+	if desc := field.Tag.Get("description"); desc != "" {
+		schema["description"] = desc
+	}
 
-			prop, req, err := getTypeSchema(field.Type)
+	target := schema
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		target = items
+	}
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		var values []interface{}
+		for _, s := range strings.Split(enum, ",") {
+			v, err := tagValue(target, strings.TrimSpace(s))
 			if err != nil {
-				return nil, false, err
+				return fmt.Errorf("enum: %w", err)
 			}
-			if desc := field.Tag.Get("description"); desc != "" {
-				prop["description"] = desc
-			}
-			properties[name] = prop
-			if req {
-				requiredFields = append(requiredFields, name)
+			values = append(values, v)
+		}
+		target["enum"] = values
+	}
+	for _, key := range []string{"minimum", "maximum"} {
+		if s, ok := field.Tag.Lookup(key); ok {
+			n, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
 			}
+			target[key] = n
 		}
-		if len(requiredFields) > 0 {
-			schema["required"] = requiredFields
+	}
+	for _, key := range []string{"pattern", "format"} {
+		if s, ok := field.Tag.Lookup(key); ok {
+			target[key] = s
 		}
-		return schema, required, nil
-	default:
-		return nil, false, fmt.Errorf("unsupported type: %v", t.Kind())
 	}
+
+	if s, ok := field.Tag.Lookup("default"); ok {
+		v, err := tagValue(schema, s)
+		if err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+		schema["default"] = v
+	}
+	if s, ok := field.Tag.Lookup("example"); ok {
+		v, err := tagValue(schema, s)
+		if err != nil {
+			return fmt.Errorf("example: %w", err)
+		}
+		schema["examples"] = []interface{}{v}
+	}
+	return nil
+}
+
+// tagValue parses a tag value as an instance of schema. Strings are taken
+// verbatim; other types are parsed as JSON.
+func tagValue(schema map[string]interface{}, s string) (interface{}, error) {
+	switch schema["type"] {
+	case "string":
+		return s, nil
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return strconv.ParseBool(s)
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
 }
 
 // FromStruct creates a tool Definition from a struct name, description and input struct.
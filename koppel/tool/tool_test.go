@@ -0,0 +1,152 @@
+package tool
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Audit struct {
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author,omitempty"`
+}
+
+type Paging struct {
+	Cursor string `json:"cursor"`
+}
+
+type schemaInput struct {
+	Audit
+	*Paging
+	Query    string             `json:"query" description:"search terms" pattern:"^\\S"`
+	Sort     string             `json:"sort,omitempty" enum:"relevance, date" default:"relevance"`
+	Limit    int                `json:"limit" minimum:"1" maximum:"50" example:"10"`
+	Tags     []string           `json:"tags" enum:"a,b"`
+	Weights  map[string]float64 `json:"weights"`
+	Filter   json.RawMessage    `json:"filter,omitzero"`
+	Extra    interface{}        `json:"extra"`
+	Email    string             `json:"email" format:"email"`
+	Data     []byte             `json:"data"`
+	Author   string             `json:"author"`
+	internal string
+	Ignored  string `json:"-"`
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema, err := GenerateSchema(schemaInput{})
+	if err != nil {
+		t.Fatalf("GenerateSchema failed: %v", err)
+	}
+	props := schema["properties"].(map[string]interface{})
+
+	want := map[string]interface{}{
+		"created_at": map[string]interface{}{"type": "string", "format": "date-time"},
+		"cursor":     map[string]interface{}{"type": "string"},
+		"query":      map[string]interface{}{"type": "string", "description": "search terms", "pattern": `^\S`},
+		"sort":       map[string]interface{}{"type": "string", "enum": []interface{}{"relevance", "date"}, "default": "relevance"},
+		"limit":      map[string]interface{}{"type": "integer", "minimum": 1.0, "maximum": 50.0, "examples": []interface{}{int64(10)}},
+		"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+			"type": "string", "enum": []interface{}{"a", "b"},
+		}},
+		"weights": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "number"}},
+		"filter":  map[string]interface{}{},
+		"extra":   map[string]interface{}{},
+		"email":   map[string]interface{}{"type": "string", "format": "email"},
+		"data":    map[string]interface{}{"type": "string", "contentEncoding": "base64"},
+		"author":  map[string]interface{}{"type": "string"},
+	}
+	if !reflect.DeepEqual(props, want) {
+		for name := range want {
+			if !reflect.DeepEqual(props[name], want[name]) {
+				t.Errorf("%s = %#v, want %#v", name, props[name], want[name])
+			}
+		}
+		for name := range props {
+			if _, ok := want[name]; !ok {
+				t.Errorf("unexpected property %s", name)
+			}
+		}
+	}
+
+	wantRequired := []string{"query", "limit", "tags", "weights", "extra", "email", "data", "author", "created_at"}
+	if !reflect.DeepEqual(schema["required"], wantRequired) {
+		t.Errorf("required = %v, want %v", schema["required"], wantRequired)
+	}
+}
+
+func TestGenerateSchema_Errors(t *testing.T) {
+	tests := map[string]interface{}{
+		"not a struct": 42,
+		"nil":          nil,
+		"bad map key":  struct{ M map[[2]int]string }{},
+		"channel":      struct{ C chan int }{},
+		"bad minimum": struct {
+			N int `minimum:"low"`
+		}{},
+		"bad enum value": struct {
+			N int `enum:"1,two"`
+		}{},
+	}
+	for name, v := range tests {
+		if _, err := GenerateSchema(v); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+type treeNode struct {
+	Value    string     `json:"value"`
+	Children []treeNode `json:"children,omitempty"`
+}
+
+type Comment struct {
+	Text    string    `json:"text"`
+	Replies []Comment `json:"replies,omitempty"`
+	Author  *User     `json:"author,omitempty"`
+}
+
+type User struct {
+	Name string `json:"name"`
+}
+
+type thread struct {
+	Title    string    `json:"title"`
+	Comments []Comment `json:"comments"`
+	Owner    User      `json:"owner" description:"thread owner"`
+}
+
+func TestGenerateSchema_Recursive(t *testing.T) {
+	schema, err := GenerateSchema(treeNode{})
+	if err != nil {
+		t.Fatalf("GenerateSchema failed: %v", err)
+	}
+	children := schema["properties"].(map[string]interface{})["children"].(map[string]interface{})
+	if ref := children["items"].(map[string]interface{})["$ref"]; ref != "#" {
+		t.Errorf("expected a reference to the root, got %v", ref)
+	}
+	if _, ok := schema["$defs"]; ok {
+		t.Error("expected no definitions for a self-referencing root")
+	}
+}
+
+func TestGenerateSchema_Defs(t *testing.T) {
+	schema, err := GenerateSchema(thread{})
+	if err != nil {
+		t.Fatalf("GenerateSchema failed: %v", err)
+	}
+	defs := schema["$defs"].(map[string]interface{})
+	if len(defs) != 2 || defs["Comment"] == nil || defs["User"] == nil {
+		t.Fatalf("expected Comment and User definitions, got %v", defs)
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	owner := props["owner"].(map[string]interface{})
+	if owner["$ref"] != "#/$defs/User" || owner["description"] != "thread owner" {
+		t.Errorf("unexpected owner schema %v", owner)
+	}
+	replies := defs["Comment"].(map[string]interface{})["properties"].(map[string]interface{})["replies"].(map[string]interface{})
+	if replies["items"].(map[string]interface{})["$ref"] != "#/$defs/Comment" {
+		t.Errorf("expected replies to reference Comment, got %v", replies)
+	}
+}
@@ -0,0 +1,318 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Issue is a single way in which arguments violate a schema. Path locates
+// the offending value, such as "items[0].name"; it is empty for the
+// arguments object itself.
+type Issue struct {
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// ValidationError reports tool arguments that are not valid JSON or do not
+// match the tool's input schema.
+type ValidationError struct {
+	Issues []Issue `json:"issues"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return "invalid arguments: " + strings.Join(msgs, "; ")
+}
+
+// ValidateArguments checks JSON arguments against schema. It supports the
+// type, enum, const, required, properties, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, date-time format,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, anyOf, oneOf, allOf
+// and $ref keywords and ignores the others. Empty arguments are treated as
+// an empty object, and null as the value of an optional property as if the
+// property were absent. The returned error is a *ValidationError listing every
+// violation found.
+func ValidateArguments(arguments string, schema interface{}) error {
+	s, err := NormalizeSchema(schema)
+	if err != nil {
+		return err
+	}
+	return validateArguments(arguments, s)
+}
+
+func validateArguments(arguments string, s map[string]interface{}) error {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(arguments), &v); err != nil {
+		return &ValidationError{Issues: []Issue{{Message: "malformed JSON: " + err.Error()}}}
+	}
+
+	defs, _ := s["$defs"].(map[string]interface{})
+	val := &validator{root: s, defs: defs}
+	val.validate(v, s, "", 0)
+	if len(val.issues) > 0 {
+		return &ValidationError{Issues: val.issues}
+	}
+	return nil
+}
+
+// maxRefDepth stops validation of cyclic references that never consume
+// any of the value.
+const maxRefDepth = 64
+
+type validator struct {
+	root   map[string]interface{}
+	defs   map[string]interface{}
+	issues []Issue
+}
+
+func (val *validator) add(path, format string, args ...interface{}) {
+	val.issues = append(val.issues, Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// check reports whether v matches schema without recording its issues.
+func (val *validator) check(v interface{}, schema map[string]interface{}, refs int) bool {
+	sub := &validator{root: val.root, defs: val.defs}
+	sub.validate(v, schema, "", refs)
+	return len(sub.issues) == 0
+}
+
+func (val *validator) validate(v interface{}, schema map[string]interface{}, path string, refs int) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target := val.resolve(ref)
+		if target == nil {
+			val.add(path, "unresolvable schema reference %q", ref)
+			return
+		}
+		if refs < maxRefDepth {
+			val.validate(v, target, path, refs+1)
+		}
+	}
+
+	if types := SchemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+		val.add(path, "expected %s, got %s", strings.Join(types, " or "), typeName(v))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !slices.ContainsFunc(enum, func(e interface{}) bool { return reflect.DeepEqual(e, v) }) {
+		val.add(path, "must be one of %s", jsonList(enum))
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		val.add(path, "must be %s", jsonList([]interface{}{c}))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		val.validateObject(v, schema, path, refs)
+	case []interface{}:
+		val.validateArray(v, schema, path, refs)
+	case string:
+		val.validateString(v, schema, path)
+	case float64:
+		val.validateNumber(v, schema, path)
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && val.matches(v, anyOf, refs) == 0 {
+		val.add(path, "must match at least one of the allowed schemas")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && val.matches(v, oneOf, refs) != 1 {
+		val.add(path, "must match exactly one of the allowed schemas")
+	}
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if s, ok := sub.(map[string]interface{}); ok {
+				val.validate(v, s, path, refs)
+			}
+		}
+	}
+}
+
+func (val *validator) resolve(ref string) map[string]interface{} {
+	if ref == "#" {
+		return val.root
+	}
+	if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+		def, _ := val.defs[name].(map[string]interface{})
+		return def
+	}
+	return nil
+}
+
+func (val *validator) matches(v interface{}, schemas []interface{}, refs int) int {
+	n := 0
+	for _, sub := range schemas {
+		if s, ok := sub.(map[string]interface{}); ok && val.check(v, s, refs) {
+			n++
+		}
+	}
+	return n
+}
+
+func (val *validator) validateObject(v map[string]interface{}, schema map[string]interface{}, path string, refs int) {
+	required := requiredNames(schema)
+	for _, name := range required {
+		if _, ok := v[name]; !ok {
+			val.add(path, "missing required property %q", name)
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		// Models often send null for optional properties, which
+		// encoding/json decodes as if the property were absent.
+		if _, ok := props[name]; ok && v[name] == nil && !slices.Contains(required, name) {
+			continue
+		}
+		if prop, ok := props[name].(map[string]interface{}); ok {
+			val.validate(v[name], prop, joinPath(path, name), refs)
+			continue
+		}
+		if _, ok := props[name]; ok {
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				val.add(path, "unknown property %q", name)
+			}
+		case map[string]interface{}:
+			val.validate(v[name], extra, joinPath(path, name), refs)
+		}
+	}
+}
+
+func (val *validator) validateArray(v []interface{}, schema map[string]interface{}, path string, refs int) {
+	if n, ok := schemaInt(schema, "minItems"); ok && len(v) < n {
+		val.add(path, "must have at least %d items", n)
+	}
+	if n, ok := schemaInt(schema, "maxItems"); ok && len(v) > n {
+		val.add(path, "must have at most %d items", n)
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range v {
+			val.validate(item, items, path+"["+strconv.Itoa(i)+"]", refs)
+		}
+	}
+}
+
+func (val *validator) validateString(v string, schema map[string]interface{}, path string) {
+	if n, ok := schemaInt(schema, "minLength"); ok && utf8.RuneCountInString(v) < n {
+		val.add(path, "must be at least %d characters long", n)
+	}
+	if n, ok := schemaInt(schema, "maxLength"); ok && utf8.RuneCountInString(v) > n {
+		val.add(path, "must be at most %d characters long", n)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		// Patterns RE2 cannot compile are not enforced.
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+			val.add(path, "must match the pattern %q", pattern)
+		}
+	}
+	if schema["format"] == "date-time" {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			val.add(path, "must be an RFC 3339 date-time")
+		}
+	}
+}
+
+func (val *validator) validateNumber(v float64, schema map[string]interface{}, path string) {
+	if min, ok := schema["minimum"].(float64); ok && v < min {
+		val.add(path, "must be at least %v", min)
+	}
+	if max, ok := schema["maximum"].(float64); ok && v > max {
+		val.add(path, "must be at most %v", max)
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && v <= min {
+		val.add(path, "must be greater than %v", min)
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && v >= max {
+		val.add(path, "must be less than %v", max)
+	}
+}
+
+func hasType(v interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+func schemaInt(schema map[string]interface{}, key string) (int, bool) {
+	f, ok := schema[key].(float64)
+	return int(f), ok
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func jsonList(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,103 @@
+package tool
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type validateInput struct {
+	City  string   `json:"city" pattern:"^[A-Z]"`
+	Unit  string   `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days  int      `json:"days" minimum:"1" maximum:"7"`
+	Tags  []string `json:"tags,omitempty"`
+	Scope *struct {
+		Country string `json:"country"`
+	} `json:"scope,omitempty"`
+}
+
+func TestValidateArguments(t *testing.T) {
+	schema, err := GenerateSchema(validateInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateArguments(`{"city":"Seoul","unit":"celsius","days":3,"tags":["a"]}`, schema); err != nil {
+		t.Errorf("expected valid arguments, got %v", err)
+	}
+	if err := ValidateArguments(`{"city":"Seoul","unit":null,"days":3,"tags":null,"scope":null}`, schema); err != nil {
+		t.Errorf("expected null optional properties to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		arguments string
+		want      []Issue
+	}{
+		{"malformed", `{"city":`, nil},
+		{"missing", `{"city":"Seoul"}`, []Issue{{Message: `missing required property "days"`}}},
+		{"null", `{"city":"Seoul","days":null}`, []Issue{{Path: "days", Message: "expected integer, got null"}}},
+		{"type", `{"city":"Seoul","days":"3"}`, []Issue{{Path: "days", Message: "expected integer, got string"}}},
+		{"integer", `{"city":"Seoul","days":2.5}`, []Issue{{Path: "days", Message: "expected integer, got number"}}},
+		{"range", `{"city":"Seoul","days":9}`, []Issue{{Path: "days", Message: "must be at most 7"}}},
+		{"enum", `{"city":"Seoul","days":1,"unit":"kelvin"}`, []Issue{{Path: "unit", Message: `must be one of "celsius", "fahrenheit"`}}},
+		{"pattern", `{"city":"seoul","days":1}`, []Issue{{Path: "city", Message: `must match the pattern "^[A-Z]"`}}},
+		{"items", `{"city":"Seoul","days":1,"tags":["a",2]}`, []Issue{{Path: "tags[1]", Message: "expected string, got number"}}},
+		{"unknown", `{"city":"Seoul","days":1,"extra":1}`, []Issue{{Message: `unknown property "extra"`}}},
+		{"nested", `{"city":"Seoul","days":1,"scope":{}}`, []Issue{{Path: "scope", Message: `missing required property "country"`}}},
+		{"several", `{"days":0}`, []Issue{
+			{Message: `missing required property "city"`},
+			{Path: "days", Message: "must be at least 1"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateArguments(tt.arguments, schema)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(verr.Issues, tt.want) {
+				t.Errorf("issues = %+v, want %+v", verr.Issues, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateArguments_Keywords(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"id": {"anyOf": [{"type": "string", "minLength": 2}, {"type": "integer"}]},
+			"when": {"type": "string", "format": "date-time"},
+			"node": {"$ref": "#/$defs/Node"}
+		},
+		"additionalProperties": false,
+		"$defs": {"Node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/Node"}}, "additionalProperties": false}}
+	}`
+
+	if err := ValidateArguments(`{"id":"ab","when":"2024-01-02T03:04:05Z","node":{"next":{}}}`, schema); err != nil {
+		t.Errorf("expected valid arguments, got %v", err)
+	}
+	err := ValidateArguments(`{"id":"a","when":"yesterday","node":{"next":{"prev":{}}},"extra":1}`, schema)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	want := []Issue{
+		{Message: `unknown property "extra"`},
+		{Path: "id", Message: "must match at least one of the allowed schemas"},
+		{Path: "node.next", Message: `unknown property "prev"`},
+		{Path: "when", Message: "must be an RFC 3339 date-time"},
+	}
+	if !reflect.DeepEqual(verr.Issues, want) {
+		t.Errorf("issues = %+v, want %+v", verr.Issues, want)
+	}
+}
+
+func TestValidationError_Error(t *testing.T) {
+	err := &ValidationError{Issues: []Issue{{Message: "a"}, {Path: "x", Message: "b"}}}
+	if got := err.Error(); got != "invalid arguments: a; x: b" {
+		t.Errorf("unexpected message %q", got)
+	}
+}